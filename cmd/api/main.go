@@ -1,48 +1,68 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
-	"time"
 
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
 	"github.com/dxas90/learn-go/internal/server"
 	"github.com/dxas90/learn-go/internal/telemetry"
 )
 
 func main() {
+	// Load configuration from file, environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Structured logging; the log package is redirected through it as well
+	slog.SetDefault(logging.New(cfg.Logging, os.Stdout))
+
 	// Initialize OpenTelemetry tracing
-	shutdown, err := telemetry.InitTracer()
+	shutdownTracer, err := telemetry.InitTracer(cfg)
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to initialize tracer: %v", err)
+		slog.Error("Failed to initialize tracer", "error", err)
+		os.Exit(1)
 	}
-	defer shutdown()
 
 	// Create and initialize the server
-	srv, err := server.NewServer()
+	srv, err := server.NewServer(cfg)
 	if err != nil {
-		log.Fatalf("[ERROR] Failed to create server: %v", err)
+		slog.Error("Failed to create server", "error", err)
+		os.Exit(1)
 	}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Initialize OpenTelemetry metrics, scraped with the server's collectors
+	shutdownMeter, err := telemetry.InitMeter(cfg, srv.Metrics().Registry())
+	if err != nil {
+		slog.Error("Failed to initialize meter", "error", err)
+		os.Exit(1)
 	}
 
-	// Get host from environment or use default
-	host := os.Getenv("HOST")
-	if host == "" {
-		host = "0.0.0.0"
+	// Flush traces and metrics once in-flight requests have drained
+	srv.OnShutdown(shutdownTracer)
+	srv.OnShutdown(shutdownMeter)
+
+	addr := cfg.Server.Addr()
+	scheme := "http"
+	if cfg.Server.TLS.Enabled {
+		scheme = "https"
 	}
 
 	// Print startup information
-	log.Printf("[INFO] 🚀 Server starting at http://%s:%s/", host, port)
-	log.Printf("[INFO] 📊 Environment: %s", os.Getenv("GO_ENV"))
-	log.Printf("[INFO] 📦 Version: %s", os.Getenv("APP_VERSION"))
-	log.Printf("[INFO] 🕐 Started at: %s", time.Now().UTC().Format(time.RFC3339))
-
-	// Start the server (blocks until error or shutdown)
-	if err := srv.Start(host + ":" + port); err != nil {
-		log.Fatalf("[ERROR] Server failed to start: %v", err)
+	slog.Info("Server starting",
+		"address", scheme+"://"+addr+"/",
+		"environment", cfg.Environment,
+		"version", cfg.App.Version,
+	)
+
+	// Start the server (blocks until error or graceful shutdown)
+	if err := srv.Start(addr); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,182 @@
+// Package apierror writes HTTP error responses as RFC 9457 problem details
+// (application/problem+json). Clients that explicitly prefer application/json
+// or another format of the render package, or select one with ?format=,
+// receive the legacy models.ErrorResponse envelope in that format instead.
+package apierror
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/negotiate"
+	"github.com/dxas90/learn-go/internal/render"
+	"github.com/dxas90/learn-go/pkg/models"
+)
+
+// Media types offered for error responses
+const (
+	ContentTypeProblem = "application/problem+json"
+	ContentTypeJSON    = "application/json"
+)
+
+// DefaultType is the problem type used when a problem has no more specific
+// type; its title is then the HTTP status phrase (RFC 9457, section 4.2.1)
+const DefaultType = "about:blank"
+
+// Extension member names set by this package
+const (
+	ExtensionRequestID = "requestId"
+	ExtensionErrors    = "errors"
+)
+
+// Problem is an RFC 9457 problem details object
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// Extensions holds additional members serialized alongside the standard ones
+	Extensions map[string]any
+}
+
+// FieldError describes one invalid part of a request, listed under the
+// "errors" extension member. Pointer is a JSON Pointer into the request body.
+type FieldError struct {
+	Detail  string `json:"detail"`
+	Pointer string `json:"pointer,omitempty"`
+}
+
+// New creates a problem of the default type for the given status
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   DefaultType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With sets an extension member and returns the problem
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+// WithErrors adds validation errors under the "errors" extension member
+func (p *Problem) WithErrors(errs ...FieldError) *Problem {
+	return p.With(ExtensionErrors, errs)
+}
+
+// Error implements the error interface
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// MarshalJSON serializes the standard members followed by the extensions.
+// Extensions cannot override standard members.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+5)
+	maps.Copy(members, p.Extensions)
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	} else {
+		delete(members, "detail")
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	} else {
+		delete(members, "instance")
+	}
+	return json.Marshal(members)
+}
+
+// Write sends p as the response to r. The instance defaults to the request
+// path and the request ID from the context is added as an extension.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if _, ok := p.Extensions[ExtensionRequestID]; !ok {
+		if id := logging.RequestID(r.Context()); id != "" {
+			p.With(ExtensionRequestID, id)
+		}
+	}
+
+	if h := w.Header(); !slices.Contains(h.Values("Vary"), "Accept") {
+		h.Add("Vary", "Accept")
+	}
+	if f, ok := legacyFormat(r); ok {
+		writeLegacy(w, f, p)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error sends a problem of the default type for status
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// NotFound is an http.HandlerFunc replying with a 404 problem
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, "No route matches "+r.URL.Path)
+}
+
+// legacyFormat returns the format selected with ?format= or, without it,
+// the one of the render formats the client explicitly lists with the highest
+// preference, as long as application/problem+json is not listed with at
+// least the same preference. Wildcards alone and a missing Accept header
+// select problem details.
+func legacyFormat(r *http.Request) (render.Format, bool) {
+	if r.URL.Query().Has(render.FormatParam) {
+		f, err := render.Negotiate(r)
+		return f, err == nil
+	}
+
+	var best render.Format
+	var legacy, problem float64
+	for _, s := range negotiate.Parse(r.Header.Get("Accept")) {
+		if s.Value == ContentTypeProblem {
+			problem = max(problem, s.Q)
+		} else if f, ok := render.Lookup(s); ok && s.Q > legacy {
+			best, legacy = f, s.Q
+		}
+	}
+	return best, legacy > 0 && legacy > problem
+}
+
+// writeLegacy sends the pre-RFC 9457 error envelope in format f
+func writeLegacy(w http.ResponseWriter, f render.Format, p *Problem) {
+	message := p.Detail
+	if message == "" {
+		message = p.Title
+	}
+	requestID, _ := p.Extensions[ExtensionRequestID].(string)
+
+	response := models.ErrorResponse{
+		Error:      true,
+		Message:    message,
+		StatusCode: p.Status,
+		RequestID:  requestID,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+	}
+	// The envelope only holds strings and numbers, so rendering cannot fail
+	render.WriteFormat(w, f, p.Status, response)
+}
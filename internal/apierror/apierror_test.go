@@ -0,0 +1,181 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/logging"
+)
+
+func TestWriteProblem(t *testing.T) {
+	req := httptest.NewRequest("POST", "/things", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-1"))
+	rr := httptest.NewRecorder()
+
+	problem := New(http.StatusUnprocessableEntity, "Validation failed").
+		WithErrors(FieldError{Detail: "must be positive", Pointer: "#/age"})
+	Write(rr, req, problem)
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != ContentTypeProblem {
+		t.Errorf("Expected %s, got %q", ContentTypeProblem, ct)
+	}
+	if vary := rr.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Expected Vary: Accept, got %q", vary)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"type":      "about:blank",
+		"title":     "Unprocessable Entity",
+		"status":    float64(422),
+		"detail":    "Validation failed",
+		"instance":  "/things",
+		"requestId": "req-1",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, body[key])
+		}
+	}
+
+	errs, ok := body["errors"].([]interface{})
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected one validation error, got %v", body["errors"])
+	}
+	if e := errs[0].(map[string]interface{}); e["pointer"] != "#/age" || e["detail"] != "must be positive" {
+		t.Errorf("Unexpected validation error: %v", e)
+	}
+}
+
+func TestWriteVaryOnce(t *testing.T) {
+	for _, accept := range []string{"", "application/xml"} {
+		req := httptest.NewRequest("GET", "/things", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		rr.Header().Add("Vary", "Accept")
+		rr.Header().Add("Vary", "Accept-Encoding")
+		Error(rr, req, http.StatusNotFound, "Not found")
+
+		if vary := rr.Header().Values("Vary"); len(vary) != 2 {
+			t.Errorf("Accept %q: expected Vary: Accept once, got %v", accept, vary)
+		}
+	}
+}
+
+func TestMarshalOmitsEmptyMembers(t *testing.T) {
+	p := New(http.StatusNotFound, "").With("status", "overridden")
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	var body map[string]interface{}
+	json.Unmarshal(data, &body)
+	if _, ok := body["detail"]; ok {
+		t.Error("Expected empty detail to be omitted")
+	}
+	if _, ok := body["instance"]; ok {
+		t.Error("Expected empty instance to be omitted")
+	}
+	if body["status"] != float64(404) {
+		t.Errorf("Expected extensions not to override status, got %v", body["status"])
+	}
+}
+
+func TestWriteNegotiation(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentTypeProblem},
+		{"*/*", ContentTypeProblem},
+		{"application/problem+json", ContentTypeProblem},
+		{"application/json", ContentTypeJSON},
+		{"application/json, text/plain, */*", ContentTypeJSON},
+		{"application/problem+json, application/json", ContentTypeProblem},
+		{"application/problem+json;q=0.5, application/json", ContentTypeJSON},
+		{"application/json;q=0", ContentTypeProblem},
+		{"application/yaml", "application/yaml"},
+		{"text/xml, application/json;q=0.5", "application/xml"},
+		{"application/problem+json, application/msgpack", ContentTypeProblem},
+		{"text/html", ContentTypeProblem},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+
+		Error(rr, req, http.StatusBadRequest, "bad")
+
+		if ct := rr.Header().Get("Content-Type"); ct != tt.want {
+			t.Errorf("Accept %q: expected %s, got %q", tt.accept, tt.want, ct)
+		}
+	}
+}
+
+func TestWriteLegacy(t *testing.T) {
+	req := httptest.NewRequest("GET", "/missing", nil)
+	req.Header.Set("Accept", "application/json")
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-2"))
+	rr := httptest.NewRecorder()
+
+	Write(rr, req, New(http.StatusNotFound, ""))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if body["error"] != true || body["statusCode"] != float64(404) {
+		t.Errorf("Unexpected legacy response: %v", body)
+	}
+	if body["message"] != "Not Found" {
+		t.Errorf("Expected message to fall back to the title, got %v", body["message"])
+	}
+	if body["requestId"] != "req-2" {
+		t.Errorf("Expected requestId='req-2', got %v", body["requestId"])
+	}
+	if _, ok := body["timestamp"]; !ok {
+		t.Error("Expected timestamp in legacy response")
+	}
+}
+
+func TestWriteFormatParam(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/?format=yaml", "application/yaml"},
+		{"/?format=json", ContentTypeJSON},
+		{"/?format=unknown", ContentTypeProblem},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Header.Set("Accept", ContentTypeProblem)
+		rr := httptest.NewRecorder()
+
+		Error(rr, req, http.StatusBadRequest, "bad")
+
+		if ct := rr.Header().Get("Content-Type"); ct != tt.want {
+			t.Errorf("%s: expected %s, got %q", tt.target, tt.want, ct)
+		}
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tt.target, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package apikey manages the API keys of service-to-service callers. Only a
+// salted hash of each key is kept; the plaintext is returned once, when the
+// key is created.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every plaintext key, making leaked keys easy to scan for
+const Prefix = "lgo_"
+
+// Errors returned by Store
+var (
+	ErrInvalidKey = errors.New("invalid API key")
+	ErrExpired    = errors.New("API key expired")
+	ErrRevoked    = errors.New("API key revoked")
+	ErrNotFound   = errors.New("API key not found")
+)
+
+// RateLimit is a per-key quota of Requests per Period
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// rateLimitJSON stores the period as a duration string such as "1m0s"
+type rateLimitJSON struct {
+	Requests int    `json:"requests"`
+	Period   string `json:"period"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (l RateLimit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rateLimitJSON{Requests: l.Requests, Period: l.Period.String()})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *RateLimit) UnmarshalJSON(data []byte) error {
+	var v rateLimitJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	period, err := time.ParseDuration(v.Period)
+	if err != nil {
+		return fmt.Errorf("invalid rate limit period: %w", err)
+	}
+	l.Requests, l.Period = v.Requests, period
+	return nil
+}
+
+// Key describes an API key. Salt and Hash verify the secret part of the
+// plaintext key, which is never stored.
+type Key struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+	Salt      string     `json:"salt"`
+	Hash      string     `json:"hash"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *Key) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// clone returns a copy of k that shares no memory with it
+func (k *Key) clone() Key {
+	c := *k
+	c.Scopes = slices.Clone(k.Scopes)
+	if k.RateLimit != nil {
+		limit := *k.RateLimit
+		c.RateLimit = &limit
+	}
+	return c
+}
+
+// Store holds API keys in memory and persists them to a JSON file after
+// every change. The file is only read at startup, so a single process
+// should manage it.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+// NewStore loads the keys kept in the file at path. A missing file is
+// created on the first change.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path, now: time.Now, keys: make(map[string]*Key)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+
+	var keys []*Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("parsing API keys %s: %w", path, err)
+	}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+// Create adds a key and returns it with its plaintext, which cannot be
+// recovered afterwards. A nil expiresAt or limit means the key never
+// expires or has no quota of its own.
+func (s *Store) Create(name string, scopes []string, expiresAt *time.Time, limit *RateLimit) (Key, string, error) {
+	id, err := randomBytes(6)
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret, err := randomBytes(32)
+	if err != nil {
+		return Key{}, "", err
+	}
+	salt, err := randomBytes(16)
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	k := &Key{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: s.now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt,
+		RateLimit: limit,
+		Salt:      base64.RawStdEncoding.EncodeToString(salt),
+	}
+	secretText := base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = hashSecret(salt, secretText)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	if err := s.save(); err != nil {
+		delete(s.keys, k.ID)
+		return Key{}, "", err
+	}
+	return k.clone(), Prefix + k.ID + "_" + secretText, nil
+}
+
+// List returns every key, including revoked and expired ones, oldest first
+func (s *Store) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k.clone())
+	}
+	slices.SortFunc(keys, func(a, b Key) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return keys
+}
+
+// Revoke disables the key with the given ID. Revoking a key twice keeps
+// the original revocation time.
+func (s *Store) Revoke(id string) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return Key{}, ErrNotFound
+	}
+	if k.RevokedAt == nil {
+		now := s.now().UTC().Truncate(time.Second)
+		k.RevokedAt = &now
+		if err := s.save(); err != nil {
+			k.RevokedAt = nil
+			return Key{}, err
+		}
+	}
+	return k.clone(), nil
+}
+
+// Authenticate returns the key matching plaintext. It fails with
+// ErrInvalidKey for unknown or malformed keys, and with ErrRevoked or
+// ErrExpired for keys that are no longer active.
+func (s *Store) Authenticate(plaintext string) (Key, error) {
+	rest, ok := strings.CutPrefix(plaintext, Prefix)
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+
+	s.mu.RLock()
+	k, ok := s.keys[id]
+	var key Key
+	if ok {
+		key = k.clone()
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(key.Salt)
+	if err != nil || subtle.ConstantTimeCompare([]byte(hashSecret(salt, secret)), []byte(key.Hash)) != 1 {
+		return Key{}, ErrInvalidKey
+	}
+
+	switch {
+	case key.RevokedAt != nil:
+		return Key{}, ErrRevoked
+	case !key.Active(s.now()):
+		return Key{}, ErrExpired
+	}
+	return key, nil
+}
+
+// save writes the keys to the store file, replacing it atomically.
+// Callers must hold the write lock.
+func (s *Store) save() error {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b *Key) int { return strings.Compare(a.ID, b.ID) })
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("saving API keys: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".api-keys-*")
+	if err != nil {
+		return fmt.Errorf("saving API keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving API keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving API keys: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("saving API keys: %w", err)
+	}
+	return nil
+}
+
+// hashSecret returns the hex SHA-256 of salt followed by secret. A fast
+// hash is enough since secrets are 256 random bits, not passwords.
+func hashSecret(salt []byte, secret string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating API key: %w", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,140 @@
+package apikey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys", "api-keys.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() returned an error: %v", err)
+	}
+	return s, path
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	s, path := newTestStore(t)
+
+	limit := &RateLimit{Requests: 10, Period: time.Minute}
+	key, plaintext, err := s.Create("billing", []string{"echo:write"}, nil, limit)
+	if err != nil {
+		t.Fatalf("Create() returned an error: %v", err)
+	}
+	if !strings.HasPrefix(plaintext, Prefix+key.ID+"_") {
+		t.Errorf("Expected plaintext to start with %s%s_, got %q", Prefix, key.ID, plaintext)
+	}
+
+	got, err := s.Authenticate(plaintext)
+	if err != nil {
+		t.Fatalf("Authenticate() returned an error: %v", err)
+	}
+	if got.Name != "billing" || got.Scopes[0] != "echo:write" || got.RateLimit.Requests != 10 {
+		t.Errorf("Unexpected key: %+v", got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected the store file to be written: %v", err)
+	}
+	secret := plaintext[strings.LastIndex(plaintext, "_")+1:]
+	if strings.Contains(string(data), secret) {
+		t.Error("Expected the store file not to contain the plaintext secret")
+	}
+
+	// Keys survive a restart
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() returned an error: %v", err)
+	}
+	got, err = reopened.Authenticate(plaintext)
+	if err != nil {
+		t.Fatalf("Authenticate() after reload returned an error: %v", err)
+	}
+	if got.RateLimit == nil || got.RateLimit.Period != time.Minute {
+		t.Errorf("Expected the rate limit to be persisted, got %+v", got.RateLimit)
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	s, _ := newTestStore(t)
+	_, plaintext, err := s.Create("billing", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strings.SplitN(strings.TrimPrefix(plaintext, Prefix), "_", 2)[0]
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"empty", ""},
+		{"no prefix", strings.TrimPrefix(plaintext, Prefix)},
+		{"unknown id", Prefix + "000000000000_secret"},
+		{"wrong secret", Prefix + id + "_secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Authenticate(tt.key); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Expected ErrInvalidKey, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateExpiredAndRevoked(t *testing.T) {
+	s, _ := newTestStore(t)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	expiresAt := now.Add(time.Hour)
+	_, expiring, _ := s.Create("expiring", nil, &expiresAt, nil)
+	revokedKey, revoked, _ := s.Create("revoked", nil, nil, nil)
+
+	if _, err := s.Authenticate(expiring); err != nil {
+		t.Errorf("Expected the key to be valid before it expires, got %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := s.Authenticate(expiring); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+
+	if _, err := s.Revoke(revokedKey.ID); err != nil {
+		t.Fatalf("Revoke() returned an error: %v", err)
+	}
+	if _, err := s.Authenticate(revoked); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Expected ErrRevoked, got %v", err)
+	}
+	if _, err := s.Revoke("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	s, _ := newTestStore(t)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	s.Create("first", nil, nil, nil)
+	now = now.Add(time.Minute)
+	second, _, _ := s.Create("second", nil, nil, nil)
+	s.Revoke(second.ID)
+
+	keys := s.List()
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(keys))
+	}
+	if keys[0].Name != "first" || keys[1].Name != "second" {
+		t.Errorf("Expected keys oldest first, got %s, %s", keys[0].Name, keys[1].Name)
+	}
+	if keys[1].RevokedAt == nil {
+		t.Error("Expected revoked keys to be listed with their revocation time")
+	}
+}
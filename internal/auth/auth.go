@@ -0,0 +1,194 @@
+// Package auth verifies JWT bearer tokens signed with RS256, ES256 or HS256
+// against static keys or a JSON Web Key Set.
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Errors returned by Verify, wrapping the underlying jwt error
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrNoKey        = errors.New("no matching verification key")
+)
+
+// Claims are the JWT claims understood by the application. Scopes are read
+// from the space-separated "scope" claim (RFC 8693) or the "scp" array.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+}
+
+// Scopes returns the granted scopes
+func (c *Claims) Scopes() []string {
+	if len(c.Scp) > 0 {
+		return c.Scp
+	}
+	return strings.Fields(c.Scope)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the verified claims
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the verified claims stored in ctx, if any
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// key is a verification key, optionally identified by a key ID
+type key struct {
+	id  string
+	key any
+}
+
+// compatible reports whether k can verify tokens signed with alg
+func (k key) compatible(alg string) bool {
+	switch k.key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	}
+	return false
+}
+
+// Verifier validates bearer tokens
+type Verifier struct {
+	parser *jwt.Parser
+	static []key
+	jwks   *jwksCache
+}
+
+// NewVerifier creates a Verifier from the configuration, loading static
+// keys immediately. A JWKS is fetched on first use.
+func NewVerifier(cfg config.AuthConfig) (*Verifier, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithLeeway(cfg.ClockSkew),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if len(cfg.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(cfg.Audience...))
+	}
+
+	v := &Verifier{parser: jwt.NewParser(opts...)}
+	for _, path := range cfg.PublicKeyFiles {
+		k, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		v.static = append(v.static, key{key: k})
+	}
+	if cfg.HMACSecret != "" {
+		v.static = append(v.static, key{key: []byte(cfg.HMACSecret)})
+	}
+
+	switch {
+	case cfg.JWKSFile != "":
+		v.jwks = newJWKSCache(fileSource(cfg.JWKSFile), cfg.JWKSRefresh)
+	case cfg.JWKSURL != "":
+		v.jwks = newJWKSCache(urlSource(cfg.JWKSURL), cfg.JWKSRefresh)
+	}
+	return v, nil
+}
+
+// Verify parses token, checks its signature and its exp, nbf, iss and aud
+// claims, and returns the claims. Errors wrap ErrInvalidToken.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		return v.keysFor(ctx, t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// keysFor returns the keys that may have signed t: those matching its kid
+// header when present, restricted to the token's algorithm family
+func (v *Verifier) keysFor(ctx context.Context, t *jwt.Token) (any, error) {
+	alg := t.Method.Alg()
+	kid, _ := t.Header["kid"].(string)
+
+	candidates := v.static
+	if v.jwks != nil {
+		jwks, err := v.jwks.keys(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates[:len(candidates):len(candidates)], jwks...)
+	}
+
+	var set jwt.VerificationKeySet
+	for _, k := range candidates {
+		if k.id != "" && kid != "" && k.id != kid {
+			continue
+		}
+		if k.compatible(alg) {
+			set.Keys = append(set.Keys, k.key)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, ErrNoKey
+	}
+	return set, nil
+}
+
+// loadPublicKey reads an RSA or ECDSA public key, or the key of a
+// certificate, from a PEM file
+func loadPublicKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	var pub any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate %s: %w", path, err)
+		}
+		pub = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key %s: %w", path, err)
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T in %s", pub, path)
+}
@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func testAuthConfig() config.AuthConfig {
+	cfg := config.Default().Auth
+	cfg.Enabled = true
+	cfg.Issuer = "https://issuer.test"
+	cfg.Audience = []string{"learn-go"}
+	return cfg
+}
+
+// validClaims returns claims accepted by testAuthConfig
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://issuer.test",
+			Subject:   "alice",
+			Audience:  jwt.ClaimStrings{"learn-go"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+		},
+		Scope: "echo:write info:read",
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims *Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func writePublicKey(t *testing.T, pub any) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyStaticKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	cfg := testAuthConfig()
+	cfg.Algorithms = []string{"RS256", "ES256", "HS256"}
+	cfg.PublicKeyFiles = []string{writePublicKey(t, &rsaKey.PublicKey), writePublicKey(t, &ecKey.PublicKey)}
+	cfg.HMACSecret = testSecret
+
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    any
+	}{
+		{"RS256", jwt.SigningMethodRS256, rsaKey},
+		{"ES256", jwt.SigningMethodES256, ecKey},
+		{"HS256", jwt.SigningMethodHS256, []byte(testSecret)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), sign(t, tt.method, tt.key, "", validClaims()))
+			if err != nil {
+				t.Fatalf("Verify() returned an error: %v", err)
+			}
+			if claims.Subject != "alice" {
+				t.Errorf("Expected subject alice, got %q", claims.Subject)
+			}
+			if scopes := claims.Scopes(); len(scopes) != 2 || scopes[0] != "echo:write" {
+				t.Errorf("Unexpected scopes: %v", scopes)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	cfg := testAuthConfig()
+	cfg.Algorithms = []string{"RS256"}
+	cfg.PublicKeyFiles = []string{writePublicKey(t, &rsaKey.PublicKey)}
+
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		token  func() string
+		reason error
+	}{
+		{"wrong key", func() string {
+			return sign(t, jwt.SigningMethodRS256, otherKey, "", validClaims())
+		}, jwt.ErrTokenSignatureInvalid},
+		{"algorithm not allowed", func() string {
+			return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", validClaims())
+		}, jwt.ErrTokenSignatureInvalid},
+		{"expired beyond skew", func() string {
+			c := validClaims()
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return sign(t, jwt.SigningMethodRS256, rsaKey, "", c)
+		}, jwt.ErrTokenExpired},
+		{"not yet valid", func() string {
+			c := validClaims()
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute))
+			return sign(t, jwt.SigningMethodRS256, rsaKey, "", c)
+		}, jwt.ErrTokenNotValidYet},
+		{"missing exp", func() string {
+			c := validClaims()
+			c.ExpiresAt = nil
+			return sign(t, jwt.SigningMethodRS256, rsaKey, "", c)
+		}, jwt.ErrTokenRequiredClaimMissing},
+		{"wrong issuer", func() string {
+			c := validClaims()
+			c.Issuer = "https://evil.test"
+			return sign(t, jwt.SigningMethodRS256, rsaKey, "", c)
+		}, jwt.ErrTokenInvalidIssuer},
+		{"wrong audience", func() string {
+			c := validClaims()
+			c.Audience = jwt.ClaimStrings{"other"}
+			return sign(t, jwt.SigningMethodRS256, rsaKey, "", c)
+		}, jwt.ErrTokenInvalidAudience},
+		{"malformed", func() string { return "not.a.jwt" }, jwt.ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token())
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Expected ErrInvalidToken, got %v", err)
+			}
+			if !errors.Is(err, tt.reason) {
+				t.Errorf("Expected %v, got %v", tt.reason, err)
+			}
+		})
+	}
+}
+
+func TestVerifyClockSkew(t *testing.T) {
+	cfg := testAuthConfig()
+	cfg.Algorithms = []string{"HS256"}
+	cfg.HMACSecret = testSecret
+	cfg.ClockSkew = time.Minute
+
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an error: %v", err)
+	}
+
+	c := validClaims()
+	c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", c)); err != nil {
+		t.Errorf("Expected a token expired within the skew to be accepted, got %v", err)
+	}
+}
+
+// jwksJSON encodes RSA public keys as a JWKS
+func jwksJSON(t *testing.T, keys map[string]*rsa.PublicKey) []byte {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, k := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifyJWKSFileRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, jwksJSON(t, map[string]*rsa.PublicKey{"old": &oldKey.PublicKey}), 0o600)
+
+	cfg := testAuthConfig()
+	cfg.JWKSFile = path
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an error: %v", err)
+	}
+	clock := time.Now()
+	v.jwks.now = func() time.Time { return clock }
+
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, oldKey, "old", validClaims())); err != nil {
+		t.Fatalf("Verify() with the current key returned an error: %v", err)
+	}
+
+	// The issuer rotates: the new key is published and signs new tokens
+	os.WriteFile(path, jwksJSON(t, map[string]*rsa.PublicKey{"new": &newKey.PublicKey}), 0o600)
+	newToken := sign(t, jwt.SigningMethodRS256, newKey, "new", validClaims())
+
+	if _, err := v.Verify(context.Background(), newToken); err == nil {
+		t.Error("Expected unknown key IDs not to trigger a refetch right after the last one")
+	}
+
+	clock = clock.Add(minRefetchInterval)
+	if _, err := v.Verify(context.Background(), newToken); err != nil {
+		t.Errorf("Expected the unknown key ID to trigger a refetch, got %v", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, oldKey, "old", validClaims())); err == nil {
+		t.Error("Expected tokens signed with the retired key to be rejected")
+	}
+}
+
+func TestVerifyJWKSURL(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var hits atomic.Int32
+	available := atomic.Bool{}
+	available.Store(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(jwksJSON(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey}))
+	}))
+	defer srv.Close()
+
+	cfg := testAuthConfig()
+	cfg.JWKSURL = srv.URL
+	cfg.JWKSRefresh = time.Minute
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an error: %v", err)
+	}
+	clock := time.Now()
+	v.jwks.now = func() time.Time { return clock }
+
+	token := sign(t, jwt.SigningMethodRS256, key, "k1", validClaims())
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(context.Background(), token); err != nil {
+			t.Fatalf("Verify() returned an error: %v", err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("Expected the JWKS to be fetched once and cached, got %d fetches", hits.Load())
+	}
+
+	// A failed refresh keeps the cached keys
+	available.Store(false)
+	clock = clock.Add(2 * time.Minute)
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Expected cached keys to be used when the refresh fails, got %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("Expected a refresh after the TTL, got %d fetches", hits.Load())
+	}
+}
+
+func TestJWKSCacheEmptySet(t *testing.T) {
+	var fetches int
+	c := newJWKSCache(func(context.Context) ([]byte, error) {
+		fetches++
+		return []byte(`{"keys": []}`), nil
+	}, time.Minute)
+	clock := time.Now()
+	c.now = func() time.Time { return clock }
+
+	for i := 0; i < 3; i++ {
+		keys, err := c.keys(context.Background(), "k1")
+		if err != nil || len(keys) != 0 {
+			t.Fatalf("Expected no keys and no error, got %v, %v", keys, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected an empty JWKS to be cached, got %d fetches", fetches)
+	}
+
+	// Once stale, refetches are still spaced by minRefetchInterval
+	clock = clock.Add(time.Minute)
+	c.keys(context.Background(), "k1")
+	c.keys(context.Background(), "k1")
+	if fetches != 2 {
+		t.Errorf("Expected one refetch after the TTL, got %d fetches", fetches)
+	}
+}
+
+func TestJWKSCacheSingleFetch(t *testing.T) {
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	c := newJWKSCache(func(context.Context) ([]byte, error) {
+		fetches.Add(1)
+		<-release
+		return []byte(`{"keys": [{"kty": "oct", "kid": "k1", "k": "c2VjcmV0"}]}`), nil
+	}, time.Minute)
+
+	// A caller giving up does not wait for the slow fetch
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.keys(ctx, "k1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the caller's deadline error, got %v", err)
+	}
+
+	results := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			keys, _ := c.keys(context.Background(), "k1")
+			results <- len(keys)
+		}()
+	}
+	close(release)
+	for i := 0; i < 5; i++ {
+		if n := <-results; n != 1 {
+			t.Errorf("Expected the fetched key, got %d keys", n)
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected concurrent callers to share one fetch, got %d", fetches.Load())
+	}
+}
+
+func TestParseJWKSSkipsUnsupportedKeys(t *testing.T) {
+	keys, err := parseJWKS([]byte(`{"keys": [
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"}
+	]}`))
+	if err != nil {
+		t.Fatalf("parseJWKS() returned an error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].id != "hmac" {
+		t.Errorf("Expected only the oct signing key, got %+v", keys)
+	}
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRefetchInterval bounds how often an unknown key ID triggers a refetch,
+// so tokens with made-up key IDs cannot hammer the JWKS endpoint
+const minRefetchInterval = 30 * time.Second
+
+// jwksSource returns the raw JSON Web Key Set
+type jwksSource func(ctx context.Context) ([]byte, error)
+
+func fileSource(path string) jwksSource {
+	return func(context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+func urlSource(url string) jwksSource {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching JWKS: unexpected status %s", resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+}
+
+// jwksCache holds the keys of a JWKS, refreshing them every ttl and when a
+// token names a key ID it does not know, at most once per
+// minRefetchInterval. The previous keys stay in use when a refresh fails.
+// Concurrent callers share one fetch, made without holding the lock.
+type jwksCache struct {
+	source jwksSource
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu          sync.Mutex
+	cached      []key
+	loaded      bool
+	fetched     time.Time
+	lastAttempt time.Time
+	lastErr     error
+	inflight    chan struct{}
+}
+
+func newJWKSCache(source jwksSource, ttl time.Duration) *jwksCache {
+	return &jwksCache{source: source, ttl: ttl, now: time.Now}
+}
+
+// keys returns the current keys, refreshing them first if needed
+func (c *jwksCache) keys(ctx context.Context, kid string) ([]key, error) {
+	c.mu.Lock()
+	now := c.now()
+	stale := !c.loaded || now.Sub(c.fetched) >= c.ttl
+	unknown := kid != "" && !hasKeyID(c.cached, kid)
+	throttled := !c.lastAttempt.IsZero() && now.Sub(c.lastAttempt) < minRefetchInterval
+	if (!stale && !unknown) || (throttled && c.inflight == nil) {
+		defer c.mu.Unlock()
+		return c.current()
+	}
+
+	done := c.inflight
+	if done == nil {
+		done = make(chan struct{})
+		c.inflight, c.lastAttempt = done, now
+		// The fetch is shared, so it does not end with this caller's request
+		go c.refresh(context.WithoutCancel(ctx), done)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return c.current()
+}
+
+// current returns the cached keys, or the last error if none were loaded.
+// c.mu must be held.
+func (c *jwksCache) current() ([]key, error) {
+	if !c.loaded {
+		return nil, c.lastErr
+	}
+	return c.cached, nil
+}
+
+// refresh fetches the keys and closes done when they, or the error, are
+// stored
+func (c *jwksCache) refresh(ctx context.Context, done chan struct{}) {
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(done)
+	c.inflight = nil
+	if err != nil {
+		c.lastErr = err
+		if c.loaded {
+			slog.WarnContext(ctx, "Failed to refresh JWKS, keeping the current keys", "error", err)
+		}
+		return
+	}
+	// A set without usable keys is still a successful fetch
+	c.cached, c.loaded, c.fetched, c.lastErr = keys, true, c.now(), nil
+}
+
+func (c *jwksCache) fetch(ctx context.Context) ([]key, error) {
+	data, err := c.source(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading JWKS: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+func hasKeyID(keys []key, kid string) bool {
+	for _, k := range keys {
+		if k.id == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// jwk is a JSON Web Key (RFC 7517) of type RSA, EC or oct
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS decodes the signature keys of a JWKS. Keys of unsupported types
+// or for encryption are skipped.
+func parseJWKS(data []byte) ([]key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	var keys []key
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWKS key %q: %w", k.Kid, err)
+		}
+		if pub != nil {
+			keys = append(keys, key{id: k.Kid, key: pub})
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the verification key, or nil for unsupported key types
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return pub, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
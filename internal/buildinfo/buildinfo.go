@@ -0,0 +1,31 @@
+// Package buildinfo describes the build the binary comes from.
+package buildinfo
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Timestamp is the build time in RFC 3339 format, set at link time with
+//
+//	-ldflags "-X github.com/dxas90/learn-go/internal/buildinfo.Timestamp=2024-01-02T15:04:05Z"
+var Timestamp string
+
+// Time returns the build time: Timestamp when it is set and valid, else the
+// commit time Go stamps into builds from a git checkout. It is the same on
+// every replica running the build, and zero when neither is known.
+func Time() time.Time {
+	if t, err := time.Parse(time.RFC3339, Timestamp); err == nil {
+		return t.UTC()
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.time" {
+				if t, err := time.Parse(time.RFC3339, s.Value); err == nil {
+					return t.UTC()
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,21 @@
+package buildinfo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	defer func(ts string) { Timestamp = ts }(Timestamp)
+
+	Timestamp = "2024-01-02T15:04:05+02:00"
+	if got, want := Time(), time.Date(2024, 1, 2, 13, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Test binaries carry no VCS stamp, so an invalid timestamp leaves none
+	Timestamp = "0000-00-00T00:00:00Z"
+	if got := Time(); !got.IsZero() {
+		t.Errorf("Expected no build time, got %v", got)
+	}
+}
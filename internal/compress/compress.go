@@ -0,0 +1,174 @@
+// Package compress provides the content codings used to compress HTTP
+// responses. Encoders are looked up by their Content-Encoding token; gzip,
+// deflate, zstd and br are built in and others can be added with Register.
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Level trades compression speed for size
+type Level string
+
+// Compression levels understood by every built-in encoder
+const (
+	LevelFastest Level = "fastest"
+	LevelDefault Level = "default"
+	LevelBest    Level = "best"
+)
+
+// Writer compresses the data written to it into an underlying writer.
+// Flush writes out pending compressed data; Close must be called to finish
+// the stream.
+type Writer interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Encoder creates writers for one content coding
+type Encoder interface {
+	// Encoding returns the Content-Encoding token, such as "gzip"
+	Encoding() string
+	// NewWriter returns a writer compressing into w
+	NewWriter(w io.Writer) Writer
+}
+
+// Factory creates an Encoder compressing at the given level
+type Factory func(level Level) (Encoder, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{
+		"gzip":    newGzip,
+		"deflate": newDeflate,
+		"zstd":    newZstd,
+		"br":      newBrotli,
+	}
+)
+
+// Register makes an encoder available under its Content-Encoding token,
+// replacing any previous one
+func Register(encoding string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[encoding] = f
+}
+
+// Encodings returns the registered Content-Encoding tokens in sorted order
+func Encodings() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the encoder registered for encoding
+func New(encoding string, level Level) (Encoder, error) {
+	mu.RLock()
+	f, ok := factories[encoding]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	switch level {
+	case LevelFastest, LevelDefault, LevelBest:
+	default:
+		return nil, fmt.Errorf("invalid compression level %q", level)
+	}
+	return f(level)
+}
+
+// pooled reuses writers, which are expensive to allocate, across responses
+type pooled struct {
+	encoding string
+	pool     sync.Pool
+}
+
+func newPooled(encoding string, newWriter func() Writer) *pooled {
+	p := &pooled{encoding: encoding}
+	p.pool.New = func() any { return newWriter() }
+	return p
+}
+
+func (p *pooled) Encoding() string {
+	return p.encoding
+}
+
+func (p *pooled) NewWriter(w io.Writer) Writer {
+	zw := p.pool.Get().(Writer)
+	zw.Reset(w)
+	return &pooledWriter{Writer: zw, pool: &p.pool}
+}
+
+// pooledWriter returns its writer to the pool when closed
+type pooledWriter struct {
+	Writer
+	pool *sync.Pool
+}
+
+func (pw *pooledWriter) Close() error {
+	if pw.Writer == nil {
+		return nil
+	}
+	err := pw.Writer.Close()
+	pw.pool.Put(pw.Writer)
+	pw.Writer = nil
+	return err
+}
+
+func newGzip(level Level) (Encoder, error) {
+	l := map[Level]int{LevelFastest: gzip.BestSpeed, LevelDefault: gzip.DefaultCompression, LevelBest: gzip.BestCompression}[level]
+	return newPooled("gzip", func() Writer {
+		zw, _ := gzip.NewWriterLevel(nil, l)
+		return zw
+	}), nil
+}
+
+// newDeflate returns the HTTP "deflate" coding, which is the zlib format
+// (RFC 1950) rather than a raw deflate stream
+func newDeflate(level Level) (Encoder, error) {
+	l := map[Level]int{LevelFastest: zlib.BestSpeed, LevelDefault: zlib.DefaultCompression, LevelBest: zlib.BestCompression}[level]
+	return newPooled("deflate", func() Writer {
+		zw, _ := zlib.NewWriterLevel(nil, l)
+		return zw
+	}), nil
+}
+
+// newZstd limits the window to 8MB, the most browsers accept for the zstd
+// content coding (RFC 8878)
+func newZstd(level Level) (Encoder, error) {
+	l := map[Level]zstd.EncoderLevel{LevelFastest: zstd.SpeedFastest, LevelDefault: zstd.SpeedDefault, LevelBest: zstd.SpeedBestCompression}[level]
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(l),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithWindowSize(8 << 20),
+	}
+	// Check the options once so the pool cannot fail later
+	if _, err := zstd.NewWriter(nil, opts...); err != nil {
+		return nil, err
+	}
+	return newPooled("zstd", func() Writer {
+		zw, _ := zstd.NewWriter(nil, opts...)
+		return zw
+	}), nil
+}
+
+func newBrotli(level Level) (Encoder, error) {
+	l := map[Level]int{LevelFastest: brotli.BestSpeed, LevelDefault: brotli.DefaultCompression, LevelBest: brotli.BestCompression}[level]
+	return newPooled("br", func() Writer {
+		return brotli.NewWriterLevel(nil, l)
+	}), nil
+}
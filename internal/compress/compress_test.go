@@ -0,0 +1,120 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decompress reads back data compressed with encoding
+func decompress(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	case "zstd":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(bytes.NewReader(data))
+		if err == nil {
+			defer d.Close()
+			r = d
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		t.Fatalf("Failed to open %s stream: %v", encoding, err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to decompress %s: %v", encoding, err)
+	}
+	return string(out)
+}
+
+func TestEncodersRoundTrip(t *testing.T) {
+	body := strings.Repeat("the quick brown fox jumps over the lazy dog ", 100)
+
+	for _, encoding := range []string{"gzip", "deflate", "zstd", "br"} {
+		for _, level := range []Level{LevelFastest, LevelDefault, LevelBest} {
+			t.Run(encoding+"/"+string(level), func(t *testing.T) {
+				enc, err := New(encoding, level)
+				if err != nil {
+					t.Fatalf("New() returned an error: %v", err)
+				}
+				if enc.Encoding() != encoding {
+					t.Errorf("Expected encoding %s, got %s", encoding, enc.Encoding())
+				}
+
+				// The second writer comes from the pool
+				for i := 0; i < 2; i++ {
+					var buf bytes.Buffer
+					zw := enc.NewWriter(&buf)
+					io.WriteString(zw, body[:100])
+					if err := zw.Flush(); err != nil {
+						t.Fatalf("Flush() returned an error: %v", err)
+					}
+					io.WriteString(zw, body[100:])
+					if err := zw.Close(); err != nil {
+						t.Fatalf("Close() returned an error: %v", err)
+					}
+
+					if buf.Len() >= len(body) {
+						t.Errorf("Expected compressed size below %d, got %d", len(body), buf.Len())
+					}
+					if got := decompress(t, encoding, buf.Bytes()); got != body {
+						t.Errorf("Round trip %d changed the body", i)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New("lzma", LevelDefault); err == nil {
+		t.Error("Expected an error for an unknown encoding")
+	}
+	if _, err := New("gzip", "max"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
+
+// identity is a pass-through encoder used to test Register
+type identity struct{}
+
+func (identity) Encoding() string { return "x-identity" }
+
+func (identity) NewWriter(w io.Writer) Writer { return &nopWriter{w} }
+
+type nopWriter struct{ io.Writer }
+
+func (*nopWriter) Close() error        { return nil }
+func (*nopWriter) Flush() error        { return nil }
+func (n *nopWriter) Reset(w io.Writer) { n.Writer = w }
+
+func TestRegister(t *testing.T) {
+	Register("x-identity", func(Level) (Encoder, error) { return identity{}, nil })
+
+	if !slices.Contains(Encodings(), "x-identity") {
+		t.Errorf("Expected x-identity in %v", Encodings())
+	}
+	enc, err := New("x-identity", LevelDefault)
+	if err != nil {
+		t.Fatalf("New() returned an error: %v", err)
+	}
+	if enc.Encoding() != "x-identity" {
+		t.Errorf("Expected the registered encoder, got %s", enc.Encoding())
+	}
+}
@@ -0,0 +1,1283 @@
+// Package config loads the application configuration.
+//
+// Values are resolved with the following precedence, lowest first:
+//
+//  1. Built-in defaults (see Default)
+//  2. The YAML configuration file (configs/config.yaml by default)
+//  3. Environment variables (PORT, HOST, GO_ENV, ...)
+//  4. Command-line flags (-port, -host, -env, ...)
+//
+// The configuration file path can be set with the -config flag or the
+// CONFIG_FILE environment variable. The default path is optional: if it does
+// not exist the defaults are used, whereas an explicitly requested file must
+// exist.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is the configuration file loaded when no path is given
+const DefaultConfigFile = "configs/config.yaml"
+
+// Config is the root application configuration
+type Config struct {
+	App         AppConfig         `yaml:"app"`
+	Server      ServerConfig      `yaml:"server"`
+	Admin       AdminConfig       `yaml:"admin"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Security    SecurityConfig    `yaml:"security_headers"`
+	Compression CompressionConfig `yaml:"compression"`
+	Cache       CacheConfig       `yaml:"cache_control"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	AccessLog   AccessLogConfig   `yaml:"access_log"`
+	RequestID   RequestIDConfig   `yaml:"request_id"`
+	RequestBody RequestBodyConfig `yaml:"request_body"`
+	Timeout     TimeoutConfig     `yaml:"timeout"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Auth        AuthConfig        `yaml:"auth"`
+	APIKeys     APIKeyConfig      `yaml:"api_keys"`
+	Health      HealthConfig      `yaml:"health"`
+	Prometheus  PrometheusConfig  `yaml:"prometheus"`
+	Telemetry   TelemetryConfig   `yaml:"telemetry"`
+	Environment string            `yaml:"environment"`
+}
+
+// AppConfig holds application metadata
+type AppConfig struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Description string `yaml:"description"`
+}
+
+// ServerConfig holds the HTTP listener settings.
+// ShutdownDelay is how long the server keeps serving after it starts failing
+// readiness, giving load balancers time to stop routing to it, and
+// ShutdownTimeout bounds how long in-flight requests may take to drain.
+// TrustedProxies lists the IPs and CIDR ranges of reverse proxies whose
+// X-Forwarded-For header identifies the client.
+type ServerConfig struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	TrustedProxies  []string      `yaml:"trusted_proxies"`
+	TLS             TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig holds the HTTPS listener settings.
+// MinVersion is 1.2 or 1.3 and CipherSuites lists Go cipher suite names
+// (TLS 1.3 suites are not configurable). ClientAuth is none, optional or
+// require; presented client certificates are verified against ClientCAFile.
+// The files are checked every ReloadInterval and reloaded when they change
+// (zero disables reloading).
+type TLSConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	MinVersion     string        `yaml:"min_version"`
+	CipherSuites   []string      `yaml:"cipher_suites"`
+	ClientCAFile   string        `yaml:"client_ca_file"`
+	ClientAuth     string        `yaml:"client_auth"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Addr returns the host:port address the server listens on
+func (s ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// AdminConfig holds the settings of the optional admin listener.
+// When enabled it serves metrics, health probes, /info, profiling (if
+// Pprof is set) and admin operations on a separate plain HTTP address,
+// and those endpoints are removed from the public listener. The admin
+// endpoints are not authenticated, so it binds the loopback interface by
+// default; on other interfaces only the network (e.g. a NetworkPolicy)
+// keeps callers away from key management, log levels and profiles.
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Host    string `yaml:"host"`
+	Port    int    `yaml:"port"`
+	Pprof   bool   `yaml:"pprof"`
+}
+
+// Addr returns the host:port address the admin listener uses
+func (a AdminConfig) Addr() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// CORSConfig holds the Cross-Origin Resource Sharing settings.
+// The inline policy applies to every route; Routes override its fields per
+// route template, with unset fields inherited.
+type CORSConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	CORSPolicy `yaml:",inline"`
+	Routes     map[string]CORSPolicy `yaml:"routes"`
+}
+
+// CORSPolicy describes which cross-origin requests are allowed.
+// AllowedOrigins holds exact origins, "*" for any origin, or wildcard
+// subdomains such as "https://*.example.com"; AllowedOriginPatterns holds
+// regular expressions matched against the whole origin. MaxAge is how long
+// browsers may cache a preflight response.
+type CORSPolicy struct {
+	AllowedOrigins        []string      `yaml:"allowed_origins"`
+	AllowedOriginPatterns []string      `yaml:"allowed_origin_patterns"`
+	AllowedMethods        []string      `yaml:"allowed_methods"`
+	AllowedHeaders        []string      `yaml:"allowed_headers"`
+	ExposedHeaders        []string      `yaml:"exposed_headers"`
+	AllowCredentials      *bool         `yaml:"allow_credentials"`
+	MaxAge                time.Duration `yaml:"max_age"`
+}
+
+// Merge returns p with the fields set in override replacing its own
+func (p CORSPolicy) Merge(override CORSPolicy) CORSPolicy {
+	if override.AllowedOrigins != nil || override.AllowedOriginPatterns != nil {
+		p.AllowedOrigins = override.AllowedOrigins
+		p.AllowedOriginPatterns = override.AllowedOriginPatterns
+	}
+	if override.AllowedMethods != nil {
+		p.AllowedMethods = override.AllowedMethods
+	}
+	if override.AllowedHeaders != nil {
+		p.AllowedHeaders = override.AllowedHeaders
+	}
+	if override.ExposedHeaders != nil {
+		p.ExposedHeaders = override.ExposedHeaders
+	}
+	if override.AllowCredentials != nil {
+		p.AllowCredentials = override.AllowCredentials
+	}
+	if override.MaxAge != 0 {
+		p.MaxAge = override.MaxAge
+	}
+	return p
+}
+
+// SecurityConfig holds the security response header settings.
+// Headers with an empty value are not sent.
+type SecurityConfig struct {
+	Enabled                   bool       `yaml:"enabled"`
+	FrameOptions              string     `yaml:"frame_options"`
+	ReferrerPolicy            string     `yaml:"referrer_policy"`
+	PermissionsPolicy         string     `yaml:"permissions_policy"`
+	CrossOriginOpenerPolicy   string     `yaml:"cross_origin_opener_policy"`
+	CrossOriginEmbedderPolicy string     `yaml:"cross_origin_embedder_policy"`
+	CrossOriginResourcePolicy string     `yaml:"cross_origin_resource_policy"`
+	HSTS                      HSTSConfig `yaml:"hsts"`
+	CSP                       CSPConfig  `yaml:"csp"`
+}
+
+// HSTSConfig holds the Strict-Transport-Security settings. The header is
+// only sent on TLS connections.
+type HSTSConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	MaxAge            time.Duration `yaml:"max_age"`
+	IncludeSubdomains bool          `yaml:"include_subdomains"`
+	Preload           bool          `yaml:"preload"`
+}
+
+// CSPConfig holds the Content-Security-Policy settings.
+// Policy applies to every route unless Routes has one for the route
+// template. A "{nonce}" placeholder is replaced with a fresh nonce per
+// request. ReportOnly sends the policy as Content-Security-Policy-Report-Only;
+// violations are reported to ReportURI when set.
+type CSPConfig struct {
+	Policy     string            `yaml:"policy"`
+	Routes     map[string]string `yaml:"routes"`
+	ReportOnly bool              `yaml:"report_only"`
+	ReportURI  string            `yaml:"report_uri"`
+}
+
+// CompressionConfig holds the response compression settings.
+// Encodings lists the content codings offered (gzip, deflate, zstd, br) in
+// order of preference when a client accepts several equally. Level is
+// fastest, default or best. Responses smaller than MinSize bytes and those
+// whose media type is in ExcludedTypes ("video/*" matches a whole type) are
+// sent uncompressed.
+type CompressionConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Encodings     []string `yaml:"encodings"`
+	Level         string   `yaml:"level"`
+	MinSize       int      `yaml:"min_size"`
+	ExcludedTypes []string `yaml:"excluded_types"`
+}
+
+// CacheConfig holds the Cache-Control policies of responses.
+// Routes sets the header per route template and Default applies to the
+// other routes when not empty. Handlers setting their own Cache-Control
+// take precedence.
+type CacheConfig struct {
+	Enabled bool              `yaml:"enabled"`
+	Default string            `yaml:"default"`
+	Routes  map[string]string `yaml:"routes"`
+}
+
+// LoggingConfig holds the log level and output format
+type LoggingConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// AccessLogConfig holds the access log settings.
+// Format is one of combined, json or logfmt. ExcludePaths are matched
+// exactly, or as a prefix when they end with "*". The values of the
+// RedactQuery parameters are masked in logged URIs.
+type AccessLogConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Format       string   `yaml:"format"`
+	ExcludePaths []string `yaml:"exclude_paths"`
+	RedactQuery  []string `yaml:"redact_query"`
+}
+
+// RequestIDConfig holds the request correlation ID settings.
+// Incoming IDs in Header longer than MaxLength or containing unsafe
+// characters are replaced with a generated one.
+type RequestIDConfig struct {
+	Header    string `yaml:"header"`
+	MaxLength int    `yaml:"max_length"`
+}
+
+// RequestBodyConfig holds the request body settings.
+// MaxBytes caps the body of every route and Routes override it per route
+// template; zero means unlimited. With Decompress, gzip and deflate encoded
+// bodies are decoded before reaching handlers, and the decoded body is
+// limited to the route's limit or MaxDecompressedBytes, whichever is lower.
+type RequestBodyConfig struct {
+	Enabled              bool             `yaml:"enabled"`
+	MaxBytes             int64            `yaml:"max_bytes"`
+	Routes               map[string]int64 `yaml:"routes"`
+	Decompress           bool             `yaml:"decompress"`
+	MaxDecompressedBytes int64            `yaml:"max_decompressed_bytes"`
+}
+
+// TimeoutConfig holds the request timeout settings.
+// Default bounds the handling of every request and Routes override it per
+// route template; zero disables the timeout. Clients may ask for a shorter
+// timeout with Header, in seconds or as a duration such as "500ms", capped
+// at the route's timeout. Timed out requests get Status, 503 or 504.
+type TimeoutConfig struct {
+	Enabled bool                     `yaml:"enabled"`
+	Default time.Duration            `yaml:"default"`
+	Routes  map[string]time.Duration `yaml:"routes"`
+	Header  string                   `yaml:"header"`
+	Status  int                      `yaml:"status"`
+}
+
+// RateLimitConfig holds the rate limiting settings.
+// Requests are counted per client, identified according to Key: ip, api_key
+// (the API key authenticated by api_keys, falling back to the IP) or
+// subject (the authenticated identity, falling back to the IP). Default applies to every
+// route with one bucket per client shared by all of them; Routes override it
+// per route template with a bucket of their own.
+type RateLimitConfig struct {
+	Enabled bool                       `yaml:"enabled"`
+	Key     string                     `yaml:"key"`
+	Default RateLimitPolicy            `yaml:"default"`
+	Routes  map[string]RateLimitPolicy `yaml:"routes"`
+}
+
+// RateLimitPolicy allows Requests per Period, in bursts of up to Requests.
+// Zero requests means unlimited. Key overrides RateLimitConfig.Key.
+type RateLimitPolicy struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Key      string        `yaml:"key"`
+}
+
+// AuthConfig holds the JWT bearer authentication settings.
+// Tokens must be signed with one of Algorithms (RS256, ES256, HS256) by a
+// key from PublicKeyFiles (PEM), HMACSecret, JWKSFile or JWKSURL; the JWKS
+// is re-read every JWKSRefresh and when a token names an unknown key ID.
+// Issuer and Audience are checked when set, and exp/nbf tolerate ClockSkew.
+type AuthConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Issuer         string        `yaml:"issuer"`
+	Audience       []string      `yaml:"audience"`
+	Algorithms     []string      `yaml:"algorithms"`
+	ClockSkew      time.Duration `yaml:"clock_skew"`
+	PublicKeyFiles []string      `yaml:"public_key_files"`
+	HMACSecret     string        `yaml:"hmac_secret"`
+	JWKSFile       string        `yaml:"jwks_file"`
+	JWKSURL        string        `yaml:"jwks_url"`
+	JWKSRefresh    time.Duration `yaml:"jwks_refresh"`
+}
+
+// APIKeyConfig holds the API key authentication settings.
+// Keys are read from Header, or from the QueryParam query parameter when it
+// is set, and checked against the salted hashes kept in File. Keys are
+// created and revoked through the admin listener.
+type APIKeyConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	File       string `yaml:"file"`
+	Header     string `yaml:"header"`
+	QueryParam string `yaml:"query_param"`
+}
+
+// HealthConfig holds the health check settings.
+// CacheTTL is how long check results are reused between probes and
+// MemoryThresholdPercent is the share of system memory the process may use
+// before the memory check fails (zero disables the threshold).
+type HealthConfig struct {
+	CacheTTL               time.Duration `yaml:"cache_ttl"`
+	MemoryThresholdPercent float64       `yaml:"memory_threshold_percent"`
+}
+
+// PrometheusConfig holds the settings of the metrics served on /metrics.
+// DurationBuckets (seconds) and SizeBuckets (bytes) are the upper bounds of
+// the classic histogram buckets. NativeHistograms also exposes the
+// histograms as native histograms to scrapers negotiating protobuf, and
+// Exemplars attaches the trace ID of sampled requests, shown in the
+// OpenMetrics format. MaxEndpoints caps the distinct endpoint label values;
+// routes beyond the cap are counted under "overflow".
+type PrometheusConfig struct {
+	DurationBuckets  []float64 `yaml:"duration_buckets"`
+	SizeBuckets      []float64 `yaml:"size_buckets"`
+	NativeHistograms bool      `yaml:"native_histograms"`
+	Exemplars        bool      `yaml:"exemplars"`
+	// RuntimeCollectors exports Go runtime and process metrics
+	RuntimeCollectors bool `yaml:"runtime_collectors"`
+	MaxEndpoints      int  `yaml:"max_endpoints"`
+}
+
+// TelemetryConfig holds the OpenTelemetry tracing and metrics settings,
+// which the standard OTEL_* environment variables override. Exporter is
+// otlp, console (stdout), file or none; with otlp, tracing is disabled when
+// OTLPEndpoint is empty. OTLPEndpoint is a host:port or a URL.
+type TelemetryConfig struct {
+	Exporter     string `yaml:"exporter"`
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// Protocol is grpc or http/protobuf
+	Protocol string `yaml:"protocol"`
+	// Insecure disables TLS for endpoints without a scheme
+	Insecure    bool               `yaml:"insecure"`
+	TLS         TelemetryTLSConfig `yaml:"tls"`
+	Headers     map[string]string  `yaml:"headers"`
+	Compression string             `yaml:"compression"`
+	Timeout     time.Duration      `yaml:"timeout"`
+	// File is the path the file exporter appends spans to
+	File string `yaml:"file"`
+	// ServiceName defaults to app.name
+	ServiceName        string            `yaml:"service_name"`
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	Sampler            SamplerConfig     `yaml:"sampler"`
+	// Propagators read and write the trace context and baggage of inbound
+	// and outbound requests: tracecontext, baggage, b3 (single header),
+	// b3multi and jaeger
+	Propagators []string `yaml:"propagators"`
+	// TraceIDHeader returns the trace ID of each request; empty disables it
+	TraceIDHeader string        `yaml:"trace_id_header"`
+	Metrics       MetricsConfig `yaml:"metrics"`
+}
+
+// MetricsConfig selects the OpenTelemetry metric exporters: otlp, which
+// shares the endpoint and transport settings of the traces, prometheus,
+// which serves the instruments on /metrics, and console. An empty list
+// disables OpenTelemetry metrics; the native Prometheus collectors remain.
+type MetricsConfig struct {
+	Exporters []string `yaml:"exporters"`
+	// Interval between pushes to the otlp and console exporters
+	Interval time.Duration `yaml:"interval"`
+}
+
+// TelemetryTLSConfig holds the CA verifying the collector and the optional
+// client certificate presented to it
+type TelemetryTLSConfig struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// SamplerConfig selects the trace sampler. Type is always_on, always_off,
+// traceidratio or ratelimited, optionally prefixed with parentbased_ to
+// follow the decision of a parent span. Arg is the sampled ratio for
+// traceidratio and the number of traces per second for ratelimited.
+type SamplerConfig struct {
+	Type string  `yaml:"type"`
+	Arg  float64 `yaml:"arg"`
+}
+
+// UseTLS reports whether the OTLP exporter connects with TLS: always for
+// https endpoints, never for http ones and unless Insecure otherwise
+func (t TelemetryConfig) UseTLS() bool {
+	switch {
+	case strings.HasPrefix(t.OTLPEndpoint, "https://"):
+		return true
+	case strings.HasPrefix(t.OTLPEndpoint, "http://"):
+		return false
+	}
+	return !t.Insecure
+}
+
+// Default returns the built-in configuration used when nothing else is set
+func Default() *Config {
+	return &Config{
+		App: AppConfig{
+			Name:    "learn-go",
+			Version: "0.0.1",
+		},
+		Server: ServerConfig{
+			Host:            "0.0.0.0",
+			Port:            8080,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+			TLS: TLSConfig{
+				MinVersion:     "1.2",
+				ClientAuth:     "none",
+				ReloadInterval: 30 * time.Second,
+			},
+		},
+		Admin: AdminConfig{
+			Host: "127.0.0.1",
+			Port: 9090,
+		},
+		CORS: CORSConfig{
+			Enabled: true,
+			CORSPolicy: CORSPolicy{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "HEAD", "POST"},
+				AllowedHeaders: []string{
+					"Content-Type", "Authorization", "X-API-Key", "X-Request-ID",
+					"traceparent", "tracestate", "baggage",
+				},
+				ExposedHeaders: []string{
+					"X-Request-ID", "X-Trace-ID", "Retry-After",
+					"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+				},
+				MaxAge: 10 * time.Minute,
+			},
+		},
+		Security: SecurityConfig{
+			Enabled:                   true,
+			FrameOptions:              "DENY",
+			ReferrerPolicy:            "strict-origin-when-cross-origin",
+			PermissionsPolicy:         "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+			CrossOriginOpenerPolicy:   "same-origin",
+			CrossOriginResourcePolicy: "same-origin",
+			HSTS: HSTSConfig{
+				Enabled:           true,
+				MaxAge:            365 * 24 * time.Hour,
+				IncludeSubdomains: true,
+			},
+			CSP: CSPConfig{
+				Policy:    "default-src 'self'",
+				ReportURI: "/csp-report",
+			},
+		},
+		Compression: CompressionConfig{
+			Enabled:   true,
+			Encodings: []string{"zstd", "br", "gzip", "deflate"},
+			Level:     "default",
+			MinSize:   1024,
+			ExcludedTypes: []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+				"video/*", "audio/*", "font/woff", "font/woff2",
+				"application/zip", "application/gzip", "application/zstd",
+				"application/x-7z-compressed", "application/x-rar-compressed",
+				"application/pdf", "application/octet-stream",
+			},
+		},
+		Cache: CacheConfig{
+			Enabled: true,
+			Default: "no-store",
+			Routes: map[string]string{
+				"/version":      "public, max-age=60",
+				"/openapi.json": "public, max-age=3600",
+				"/openapi.yaml": "public, max-age=3600",
+			},
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		AccessLog: AccessLogConfig{
+			Enabled:      true,
+			Format:       "json",
+			ExcludePaths: []string{"/metrics", "/healthz", "/livez", "/readyz", "/startupz"},
+		},
+		RequestID: RequestIDConfig{
+			Header:    "X-Request-ID",
+			MaxLength: 128,
+		},
+		RequestBody: RequestBodyConfig{
+			Enabled:  true,
+			MaxBytes: 1 << 20,
+			Routes: map[string]int64{
+				"/csp-report": 64 << 10,
+			},
+			Decompress:           true,
+			MaxDecompressedBytes: 10 << 20,
+		},
+		Timeout: TimeoutConfig{
+			Enabled: true,
+			Default: 10 * time.Second,
+			Routes: map[string]time.Duration{
+				"/info": 2 * time.Second,
+			},
+			Header: "X-Request-Timeout",
+			Status: http.StatusServiceUnavailable,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Key:     "ip",
+			Default: RateLimitPolicy{Requests: 600, Period: time.Minute},
+			Routes: map[string]RateLimitPolicy{
+				"/echo":     {Requests: 60, Period: time.Minute},
+				"/info":     {Requests: 30, Period: time.Minute},
+				"/metrics":  {},
+				"/healthz":  {},
+				"/livez":    {},
+				"/readyz":   {},
+				"/startupz": {},
+			},
+		},
+		Auth: AuthConfig{
+			Algorithms:  []string{"RS256", "ES256"},
+			ClockSkew:   30 * time.Second,
+			JWKSRefresh: 5 * time.Minute,
+		},
+		APIKeys: APIKeyConfig{
+			File:   "data/api-keys.json",
+			Header: "X-API-Key",
+		},
+		Health: HealthConfig{
+			CacheTTL:               time.Second,
+			MemoryThresholdPercent: 90,
+		},
+		Prometheus: PrometheusConfig{
+			DurationBuckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			SizeBuckets:       []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304},
+			NativeHistograms:  true,
+			Exemplars:         true,
+			RuntimeCollectors: true,
+			MaxEndpoints:      100,
+		},
+		Telemetry: TelemetryConfig{
+			Exporter:      "otlp",
+			Protocol:      "grpc",
+			Insecure:      true,
+			Compression:   "none",
+			Timeout:       10 * time.Second,
+			File:          "traces.jsonl",
+			Sampler:       SamplerConfig{Type: "parentbased_always_on", Arg: 1},
+			Propagators:   []string{"tracecontext", "baggage"},
+			TraceIDHeader: "X-Trace-ID",
+			Metrics: MetricsConfig{
+				Exporters: []string{"prometheus", "otlp"},
+				Interval:  time.Minute,
+			},
+		},
+		Environment: "development",
+	}
+}
+
+// Load builds the configuration from defaults, the configuration file,
+// environment variables and the given command-line arguments (without the
+// program name), then validates the result.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("learn-go", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to the YAML configuration file (env CONFIG_FILE)")
+	host := fs.String("host", "", "address to listen on (env HOST)")
+	port := fs.Int("port", 0, "port to listen on (env PORT)")
+	env := fs.String("env", "", "deployment environment (env GO_ENV)")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error (env LOG_LEVEL)")
+	logFormat := fs.String("log-format", "", "log format: json or text (env LOG_FORMAT)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path, required := *configFile, true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, required = DefaultConfigFile, false
+	}
+	if err := cfg.loadFile(path, required); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	// Only flags explicitly passed on the command line override other sources
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.Server.Host = *host
+		case "port":
+			cfg.Server.Port = *port
+		case "env":
+			cfg.Environment = *env
+		case "log-level":
+			cfg.Logging.Level = *logLevel
+		case "log-format":
+			cfg.Logging.Format = *logFormat
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the YAML file at path onto the configuration.
+// A missing file is only an error when required is true.
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overlays environment variables onto the configuration
+func (c *Config) applyEnv() error {
+	setString := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+
+	setString("HOST", &c.Server.Host)
+	setString("GO_ENV", &c.Environment)
+	setString("APP_VERSION", &c.App.Version)
+	setString("LOG_LEVEL", &c.Logging.Level)
+	setString("LOG_FORMAT", &c.Logging.Format)
+	setString("ACCESS_LOG_FORMAT", &c.AccessLog.Format)
+	setString("AUTH_ISSUER", &c.Auth.Issuer)
+	setString("AUTH_HMAC_SECRET", &c.Auth.HMACSecret)
+	setString("AUTH_JWKS_URL", &c.Auth.JWKSURL)
+	setString("TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	setString("TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+	setString("TLS_CLIENT_CA_FILE", &c.Server.TLS.ClientCAFile)
+	setString("TLS_CLIENT_AUTH", &c.Server.TLS.ClientAuth)
+
+	if v := os.Getenv("TLS_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid TLS_ENABLED %q: %w", v, err)
+		}
+		c.Server.TLS.Enabled = enabled
+	}
+
+	if v := os.Getenv("AUTH_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid AUTH_ENABLED %q: %w", v, err)
+		}
+		c.Auth.Enabled = enabled
+	}
+	// CORS_ORIGIN is the single-origin predecessor of CORS_ALLOWED_ORIGINS
+	if v := os.Getenv("CORS_ORIGIN"); v != "" {
+		c.CORS.AllowedOrigins = []string{v}
+	}
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		c.CORS.AllowedOrigins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, origin)
+			}
+		}
+	}
+
+	if v := os.Getenv("COMPRESSION_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid COMPRESSION_ENABLED %q: %w", v, err)
+		}
+		c.Compression.Enabled = enabled
+	}
+	if v := os.Getenv("REQUEST_BODY_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid REQUEST_BODY_MAX_BYTES %q: %w", v, err)
+		}
+		c.RequestBody.MaxBytes = n
+	}
+	if v := os.Getenv("REQUEST_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid REQUEST_TIMEOUT %q: %w", v, err)
+		}
+		c.Timeout.Default = d
+	}
+	if v := os.Getenv("API_KEYS_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid API_KEYS_ENABLED %q: %w", v, err)
+		}
+		c.APIKeys.Enabled = enabled
+	}
+	if v := os.Getenv("API_KEYS_FILE"); v != "" {
+		c.APIKeys.File = v
+	}
+	if v := os.Getenv("RATE_LIMIT_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid RATE_LIMIT_ENABLED %q: %w", v, err)
+		}
+		c.RateLimit.Enabled = enabled
+	}
+	if v := os.Getenv("ADMIN_ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid ADMIN_ENABLED %q: %w", v, err)
+		}
+		c.Admin.Enabled = enabled
+	}
+	setString("ADMIN_HOST", &c.Admin.Host)
+	if v := os.Getenv("ADMIN_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid ADMIN_PORT %q: %w", v, err)
+		}
+		c.Admin.Port = port
+	}
+
+	if v := os.Getenv("PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid PORT %q: %w", v, err)
+		}
+		c.Server.Port = port
+	}
+	return c.Telemetry.applyEnv()
+}
+
+// applyEnv overlays the OpenTelemetry environment variables. The
+// OTEL_EXPORTER_OTLP_TRACES_* variables take precedence over their
+// OTEL_EXPORTER_OTLP_* counterparts.
+func (t *TelemetryConfig) applyEnv() error {
+	otlpEnv := func(name string) (string, string) {
+		for _, key := range []string{"OTEL_EXPORTER_OTLP_TRACES_" + name, "OTEL_EXPORTER_OTLP_" + name} {
+			if v := os.Getenv(key); v != "" {
+				return key, v
+			}
+		}
+		return "", ""
+	}
+	setOTLP := func(name string, dst *string) {
+		if _, v := otlpEnv(name); v != "" {
+			*dst = v
+		}
+	}
+	setString := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+
+	var sdkDisabled bool
+	if v := os.Getenv("OTEL_SDK_DISABLED"); v != "" {
+		var err error
+		if sdkDisabled, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid OTEL_SDK_DISABLED %q: %w", v, err)
+		}
+	}
+	if v := os.Getenv("OTEL_TRACES_EXPORTER"); v != "" {
+		t.Exporter = v
+	}
+	if v := os.Getenv("OTEL_METRICS_EXPORTER"); v != "" {
+		t.Metrics.Exporters = splitNames(v)
+	}
+	if v := os.Getenv("OTEL_PROPAGATORS"); v != "" {
+		t.Propagators = splitNames(v)
+	}
+	setOTLP("ENDPOINT", &t.OTLPEndpoint)
+	setOTLP("PROTOCOL", &t.Protocol)
+	setOTLP("COMPRESSION", &t.Compression)
+	setOTLP("CERTIFICATE", &t.TLS.CAFile)
+	setOTLP("CLIENT_CERTIFICATE", &t.TLS.CertFile)
+	setOTLP("CLIENT_KEY", &t.TLS.KeyFile)
+	setString("OTEL_SERVICE_NAME", &t.ServiceName)
+	setString("OTEL_TRACES_SAMPLER", &t.Sampler.Type)
+
+	if key, v := otlpEnv("INSECURE"); v != "" {
+		insecure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, v, err)
+		}
+		t.Insecure = insecure
+	}
+	if key, v := otlpEnv("TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", key, v, err)
+		}
+		t.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	if key, v := otlpEnv("HEADERS"); v != "" {
+		headers, err := parseKeyValues(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if t.Headers == nil {
+			t.Headers = make(map[string]string)
+		}
+		maps.Copy(t.Headers, headers)
+	}
+	if v := os.Getenv("OTEL_RESOURCE_ATTRIBUTES"); v != "" {
+		attrs, err := parseKeyValues(v)
+		if err != nil {
+			return fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+		}
+		if t.ResourceAttributes == nil {
+			t.ResourceAttributes = make(map[string]string)
+		}
+		maps.Copy(t.ResourceAttributes, attrs)
+	}
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		arg, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q: %w", v, err)
+		}
+		t.Sampler.Arg = arg
+	}
+	if v := os.Getenv("OTEL_METRIC_EXPORT_INTERVAL"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid OTEL_METRIC_EXPORT_INTERVAL %q: %w", v, err)
+		}
+		t.Metrics.Interval = time.Duration(ms) * time.Millisecond
+	}
+	if sdkDisabled {
+		t.Exporter = "none"
+		t.Metrics.Exporters = nil
+	}
+	return nil
+}
+
+// splitNames parses a comma-separated list of names such as
+// OTEL_METRICS_EXPORTER, where none stands for an empty list
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" && name != "none" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseKeyValues parses a comma-separated list of key=value pairs with
+// percent-encoded values, as used by OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_RESOURCE_ATTRIBUTES
+func parseKeyValues(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", key, err)
+		}
+		pairs[key] = value
+	}
+	return pairs, nil
+}
+
+// Validate checks that the configuration values are usable and returns
+// every problem found joined into a single error.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.App.Name == "" {
+		errs = append(errs, errors.New("app.name must not be empty"))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		errs = append(errs, errors.New("server timeouts must not be negative"))
+	}
+	if c.Server.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("server.shutdown_delay must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: invalid IP or CIDR %q", p))
+		}
+	}
+	errs = append(errs, c.Server.TLS.validate()...)
+	if c.Admin.Enabled {
+		if c.Admin.Port < 1 || c.Admin.Port > 65535 {
+			errs = append(errs, fmt.Errorf("admin.port must be between 1 and 65535, got %d", c.Admin.Port))
+		} else if c.Admin.Port == c.Server.Port {
+			errs = append(errs, fmt.Errorf("admin.port must differ from server.port (%d)", c.Server.Port))
+		}
+	}
+	if c.CORS.Enabled {
+		errs = append(errs, c.CORS.validate()...)
+	}
+	if c.Security.HSTS.Enabled && c.Security.HSTS.MaxAge < 0 {
+		errs = append(errs, errors.New("security_headers.hsts.max_age must not be negative"))
+	}
+	if c.Security.HSTS.Preload && (c.Security.HSTS.MaxAge < 365*24*time.Hour || !c.Security.HSTS.IncludeSubdomains) {
+		errs = append(errs, errors.New("security_headers.hsts.preload requires max_age of at least one year and include_subdomains"))
+	}
+	if c.Compression.Enabled {
+		errs = append(errs, c.Compression.validate()...)
+	}
+	switch c.AccessLog.Format {
+	case "combined", "json", "logfmt":
+	default:
+		errs = append(errs, fmt.Errorf("access_log.format must be combined, json or logfmt, got %q", c.AccessLog.Format))
+	}
+	if c.RequestID.Header == "" {
+		errs = append(errs, errors.New("request_id.header must not be empty"))
+	}
+	if c.RequestID.MaxLength < 1 {
+		errs = append(errs, fmt.Errorf("request_id.max_length must be positive, got %d", c.RequestID.MaxLength))
+	}
+	if c.RequestBody.MaxBytes < 0 || c.RequestBody.MaxDecompressedBytes < 0 {
+		errs = append(errs, errors.New("request_body.max_bytes and request_body.max_decompressed_bytes must not be negative"))
+	}
+	for route, n := range c.RequestBody.Routes {
+		if n < 0 {
+			errs = append(errs, fmt.Errorf("request_body.routes[%s] must not be negative", route))
+		}
+	}
+	if c.Timeout.Enabled {
+		errs = append(errs, c.Timeout.validate(c.Server.WriteTimeout)...)
+	}
+	errs = append(errs, c.RateLimit.validate()...)
+	if c.Auth.Enabled {
+		errs = append(errs, c.Auth.validate()...)
+	}
+	if c.APIKeys.Enabled {
+		if c.APIKeys.File == "" {
+			errs = append(errs, errors.New("api_keys.file is required when api_keys is enabled"))
+		}
+		if c.APIKeys.Header == "" {
+			errs = append(errs, errors.New("api_keys.header must not be empty"))
+		}
+		// Keys are issued and revoked on the admin listener only
+		if !c.Admin.Enabled {
+			errs = append(errs, errors.New("api_keys requires admin.enabled, which serves /admin/api-keys"))
+		}
+	}
+	if c.Health.CacheTTL < 0 {
+		errs = append(errs, errors.New("health.cache_ttl must not be negative"))
+	}
+	if c.Health.MemoryThresholdPercent < 0 || c.Health.MemoryThresholdPercent > 100 {
+		errs = append(errs, fmt.Errorf("health.memory_threshold_percent must be between 0 and 100, got %v", c.Health.MemoryThresholdPercent))
+	}
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("logging.level must be debug, info, warn or error, got %q", c.Logging.Level))
+	}
+	switch strings.ToLower(c.Logging.Format) {
+	case "json", "text":
+	default:
+		errs = append(errs, fmt.Errorf("logging.format must be json or text, got %q", c.Logging.Format))
+	}
+	errs = append(errs, c.Prometheus.validate()...)
+	errs = append(errs, c.Telemetry.validate()...)
+	if c.Environment == "" {
+		errs = append(errs, errors.New("environment must not be empty"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p PrometheusConfig) validate() []error {
+	var errs []error
+	check := func(name string, buckets []float64) {
+		if len(buckets) == 0 {
+			errs = append(errs, fmt.Errorf("prometheus.%s must not be empty", name))
+		}
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i] <= buckets[i-1] {
+				errs = append(errs, fmt.Errorf("prometheus.%s must be in increasing order, got %v", name, buckets))
+				break
+			}
+		}
+	}
+	check("duration_buckets", p.DurationBuckets)
+	check("size_buckets", p.SizeBuckets)
+	if p.MaxEndpoints <= 0 {
+		errs = append(errs, fmt.Errorf("prometheus.max_endpoints must be positive, got %d", p.MaxEndpoints))
+	}
+	return errs
+}
+
+func (t TelemetryConfig) validate() []error {
+	var errs []error
+	switch t.Exporter {
+	case "none", "console", "otlp":
+	case "file":
+		if t.File == "" {
+			errs = append(errs, errors.New("telemetry.file is required with the file exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("telemetry.exporter must be otlp, console, file or none, got %q", t.Exporter))
+	}
+	for _, name := range t.Metrics.Exporters {
+		switch name {
+		case "otlp", "prometheus", "console":
+		default:
+			errs = append(errs, fmt.Errorf("telemetry.metrics.exporters must contain otlp, prometheus or console, got %q", name))
+		}
+	}
+	for _, name := range t.Propagators {
+		switch name {
+		case "tracecontext", "baggage", "b3", "b3multi", "jaeger":
+		default:
+			errs = append(errs, fmt.Errorf("telemetry.propagators must contain tracecontext, baggage, b3, b3multi or jaeger, got %q", name))
+		}
+	}
+	if len(t.Metrics.Exporters) > 0 && t.Metrics.Interval <= 0 {
+		errs = append(errs, errors.New("telemetry.metrics.interval must be positive"))
+	}
+
+	if t.Exporter == "otlp" || slices.Contains(t.Metrics.Exporters, "otlp") {
+		switch t.Protocol {
+		case "grpc", "http/protobuf":
+		default:
+			errs = append(errs, fmt.Errorf("telemetry.protocol must be grpc or http/protobuf, got %q", t.Protocol))
+		}
+		if strings.Contains(t.OTLPEndpoint, "://") {
+			if u, err := url.Parse(t.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("telemetry.otlp_endpoint must be host:port or an http(s) URL, got %q", t.OTLPEndpoint))
+			}
+		}
+		switch t.Compression {
+		case "none", "gzip":
+		default:
+			errs = append(errs, fmt.Errorf("telemetry.compression must be none or gzip, got %q", t.Compression))
+		}
+		if t.Timeout <= 0 {
+			errs = append(errs, errors.New("telemetry.timeout must be positive"))
+		}
+		if (t.TLS.CertFile == "") != (t.TLS.KeyFile == "") {
+			errs = append(errs, errors.New("telemetry.tls.cert_file and telemetry.tls.key_file must be set together"))
+		}
+		if !t.UseTLS() && (t.TLS.CAFile != "" || t.TLS.CertFile != "") {
+			errs = append(errs, errors.New("telemetry.tls requires an https endpoint or telemetry.insecure set to false"))
+		}
+	}
+
+	switch strings.TrimPrefix(t.Sampler.Type, "parentbased_") {
+	case "always_on", "always_off":
+	case "traceidratio":
+		if t.Sampler.Arg < 0 || t.Sampler.Arg > 1 {
+			errs = append(errs, fmt.Errorf("telemetry.sampler.arg must be between 0 and 1 for traceidratio, got %v", t.Sampler.Arg))
+		}
+	case "ratelimited":
+		if t.Sampler.Arg <= 0 {
+			errs = append(errs, fmt.Errorf("telemetry.sampler.arg must be a positive number of traces per second for ratelimited, got %v", t.Sampler.Arg))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("telemetry.sampler.type must be always_on, always_off, traceidratio or ratelimited, optionally prefixed with parentbased_, got %q", t.Sampler.Type))
+	}
+	return errs
+}
+
+func (t TLSConfig) validate() []error {
+	var errs []error
+	if t.Enabled && (t.CertFile == "" || t.KeyFile == "") {
+		errs = append(errs, errors.New("server.tls.cert_file and server.tls.key_file are required when tls is enabled"))
+	}
+	switch t.MinVersion {
+	case "1.2", "1.3":
+	default:
+		errs = append(errs, fmt.Errorf("server.tls.min_version must be 1.2 or 1.3, got %q", t.MinVersion))
+	}
+	switch t.ClientAuth {
+	case "none":
+	case "optional", "require":
+		if t.ClientCAFile == "" {
+			errs = append(errs, fmt.Errorf("server.tls.client_ca_file is required when client_auth is %s", t.ClientAuth))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("server.tls.client_auth must be none, optional or require, got %q", t.ClientAuth))
+	}
+	if t.ReloadInterval < 0 {
+		errs = append(errs, errors.New("server.tls.reload_interval must not be negative"))
+	}
+	return errs
+}
+
+func (c CORSConfig) validate() []error {
+	errs := c.CORSPolicy.validate("cors")
+	if len(c.AllowedOrigins) == 0 && len(c.AllowedOriginPatterns) == 0 {
+		errs = append(errs, errors.New("cors.allowed_origins or cors.allowed_origin_patterns must not be empty when cors is enabled"))
+	}
+	for route, p := range c.Routes {
+		errs = append(errs, c.CORSPolicy.Merge(p).validate(fmt.Sprintf("cors.routes[%s]", route))...)
+	}
+	return errs
+}
+
+func (p CORSPolicy) validate(name string) []error {
+	var errs []error
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			if p.AllowCredentials != nil && *p.AllowCredentials {
+				errs = append(errs, fmt.Errorf("%s: allow_credentials cannot be combined with the \"*\" origin", name))
+			}
+			continue
+		}
+		scheme, host, ok := strings.Cut(origin, "://")
+		if !ok || scheme == "" || host == "" || strings.Contains(host, "/") ||
+			strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			errs = append(errs, fmt.Errorf("%s.allowed_origins: invalid origin %q", name, origin))
+		}
+	}
+	for _, pattern := range p.AllowedOriginPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s.allowed_origin_patterns: %w", name, err))
+		}
+	}
+	if p.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_age must not be negative", name))
+	}
+	return errs
+}
+
+func (c CompressionConfig) validate() []error {
+	var errs []error
+	if len(c.Encodings) == 0 {
+		errs = append(errs, errors.New("compression.encodings must not be empty when compression is enabled"))
+	}
+	for _, e := range c.Encodings {
+		switch e {
+		case "gzip", "deflate", "zstd", "br":
+		default:
+			errs = append(errs, fmt.Errorf("compression.encodings: unsupported encoding %q", e))
+		}
+	}
+	switch c.Level {
+	case "fastest", "default", "best":
+	default:
+		errs = append(errs, fmt.Errorf("compression.level must be fastest, default or best, got %q", c.Level))
+	}
+	if c.MinSize < 0 {
+		errs = append(errs, errors.New("compression.min_size must not be negative"))
+	}
+	return errs
+}
+
+// validate also requires timeouts to end before writeTimeout, after which
+// the server closes the connection without a response
+func (t TimeoutConfig) validate(writeTimeout time.Duration) []error {
+	var errs []error
+	check := func(name string, d time.Duration) {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", name))
+		}
+		if writeTimeout > 0 && d >= writeTimeout {
+			errs = append(errs, fmt.Errorf("%s must be shorter than server.write_timeout (%s)", name, writeTimeout))
+		}
+	}
+	check("timeout.default", t.Default)
+	for route, d := range t.Routes {
+		check(fmt.Sprintf("timeout.routes[%s]", route), d)
+	}
+	if t.Status != http.StatusServiceUnavailable && t.Status != http.StatusGatewayTimeout {
+		errs = append(errs, fmt.Errorf("timeout.status must be 503 or 504, got %d", t.Status))
+	}
+	return errs
+}
+
+func (r RateLimitConfig) validate() []error {
+	var errs []error
+	validKey := func(name, key string) {
+		switch key {
+		case "ip", "api_key", "subject":
+		default:
+			errs = append(errs, fmt.Errorf("%s must be ip, api_key or subject, got %q", name, key))
+		}
+	}
+	validPolicy := func(name string, p RateLimitPolicy) {
+		if p.Requests < 0 {
+			errs = append(errs, fmt.Errorf("%s.requests must not be negative", name))
+		}
+		if p.Requests > 0 && p.Period <= 0 {
+			errs = append(errs, fmt.Errorf("%s.period must be positive", name))
+		}
+		if p.Key != "" {
+			validKey(name+".key", p.Key)
+		}
+	}
+
+	validKey("rate_limit.key", r.Key)
+	validPolicy("rate_limit.default", r.Default)
+	for route, p := range r.Routes {
+		validPolicy(fmt.Sprintf("rate_limit.routes[%s]", route), p)
+	}
+	return errs
+}
+
+func (a AuthConfig) validate() []error {
+	var errs []error
+	if len(a.Algorithms) == 0 {
+		errs = append(errs, errors.New("auth.algorithms must not be empty"))
+	}
+	for _, alg := range a.Algorithms {
+		switch alg {
+		case "RS256", "ES256":
+			if len(a.PublicKeyFiles) == 0 && a.JWKSFile == "" && a.JWKSURL == "" {
+				errs = append(errs, fmt.Errorf("auth: %s requires public_key_files, jwks_file or jwks_url", alg))
+			}
+		case "HS256":
+			if len(a.HMACSecret) < 32 {
+				errs = append(errs, errors.New("auth.hmac_secret must be at least 32 bytes for HS256"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("auth.algorithms: unsupported algorithm %q", alg))
+		}
+	}
+	if a.JWKSFile != "" && a.JWKSURL != "" {
+		errs = append(errs, errors.New("auth.jwks_file and auth.jwks_url are mutually exclusive"))
+	}
+	if a.ClockSkew < 0 {
+		errs = append(errs, errors.New("auth.clock_skew must not be negative"))
+	}
+	if (a.JWKSFile != "" || a.JWKSURL != "") && a.JWKSRefresh <= 0 {
+		errs = append(errs, errors.New("auth.jwks_refresh must be positive"))
+	}
+	return errs
+}
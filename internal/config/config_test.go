@@ -0,0 +1,509 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Default() configuration is invalid: %v", err)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+
+	if cfg.Server.Port != 8080 {
+		t.Errorf("Expected default port 8080, got %d", cfg.Server.Port)
+	}
+	if cfg.Server.WriteTimeout != 15*time.Second {
+		t.Errorf("Expected default write timeout 15s, got %v", cfg.Server.WriteTimeout)
+	}
+}
+
+func TestLoadAdmin(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	// The unauthenticated admin endpoints stay local unless configured otherwise
+	if cfg.Admin.Host != "127.0.0.1" || cfg.Admin.Pprof {
+		t.Errorf("Expected a loopback admin listener without pprof, got %+v", cfg.Admin)
+	}
+
+	t.Setenv("ADMIN_HOST", "0.0.0.0")
+	cfg, err = Load(nil)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	if cfg.Admin.Host != "0.0.0.0" {
+		t.Errorf("Expected ADMIN_HOST to set the admin host, got %q", cfg.Admin.Host)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfigFile(t, `
+app:
+  name: file-app
+server:
+  host: 127.0.0.1
+  port: 9000
+  read_timeout: 5s
+logging:
+  level: debug
+  format: text
+environment: staging
+`)
+
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+
+	if cfg.App.Name != "file-app" {
+		t.Errorf("Expected app name 'file-app', got %q", cfg.App.Name)
+	}
+	if cfg.Server.Addr() != "127.0.0.1:9000" {
+		t.Errorf("Expected address 127.0.0.1:9000, got %q", cfg.Server.Addr())
+	}
+	if cfg.Server.ReadTimeout != 5*time.Second {
+		t.Errorf("Expected read timeout 5s, got %v", cfg.Server.ReadTimeout)
+	}
+	// Values missing from the file keep their defaults
+	if cfg.Server.IdleTimeout != 60*time.Second {
+		t.Errorf("Expected default idle timeout 60s, got %v", cfg.Server.IdleTimeout)
+	}
+	if cfg.Environment != "staging" {
+		t.Errorf("Expected environment 'staging', got %q", cfg.Environment)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: 9000
+  host: 10.0.0.1
+environment: staging
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "9100")
+	t.Setenv("GO_ENV", "production")
+
+	cfg, err := Load([]string{"-port", "9200"})
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+
+	if cfg.Server.Port != 9200 {
+		t.Errorf("Expected flag to win with port 9200, got %d", cfg.Server.Port)
+	}
+	if cfg.Environment != "production" {
+		t.Errorf("Expected env var to override file, got %q", cfg.Environment)
+	}
+	if cfg.Server.Host != "10.0.0.1" {
+		t.Errorf("Expected file to override default host, got %q", cfg.Server.Host)
+	}
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("Expected an error for a missing configuration file")
+	}
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("PORT", "not-a-port")
+
+	if _, err := Load(nil); err == nil {
+		t.Error("Expected an error for an invalid PORT")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Logging.Level = "verbose"
+	cfg.Logging.Format = "xml"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"server.port", "logging.level", "logging.format"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	cfg := Default()
+	cfg.Server.TLS.Enabled = true
+	cfg.Server.TLS.MinVersion = "1.0"
+	cfg.Server.TLS.ClientAuth = "require"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"server.tls.cert_file", "server.tls.min_version", "server.tls.client_ca_file"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateAdmin(t *testing.T) {
+	cfg := Default()
+	cfg.Admin.Enabled = true
+	cfg.Admin.Port = cfg.Server.Port
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "admin.port") {
+		t.Errorf("Expected an admin.port validation error, got: %v", err)
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	cfg := Default()
+	cfg.RateLimit.Key = "cookie"
+	cfg.RateLimit.Routes["/echo"] = RateLimitPolicy{Requests: 5}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"rate_limit.key", "rate_limit.routes[/echo].period"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.Enabled = true
+	cfg.Auth.Algorithms = []string{"RS256", "HS256", "none"}
+	cfg.Auth.HMACSecret = "short"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"RS256 requires", "auth.hmac_secret", `unsupported algorithm "none"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateAPIKeys(t *testing.T) {
+	cfg := Default()
+	cfg.APIKeys.Enabled = true
+	cfg.APIKeys.File = ""
+	cfg.APIKeys.Header = ""
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"api_keys.file", "api_keys.header", "api_keys requires admin.enabled"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+
+	cfg = Default()
+	cfg.APIKeys.Enabled = true
+	cfg.Admin.Enabled = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected API keys with the admin listener to be valid, got: %v", err)
+	}
+}
+
+func TestLoadCORS(t *testing.T) {
+	path := writeConfigFile(t, `
+cors:
+  allowed_origins: [https://app.example.com]
+  max_age: 1m
+  routes:
+    /echo:
+      allowed_methods: [POST]
+      allow_credentials: true
+`)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://*.example.org")
+
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+
+	if got := cfg.CORS.AllowedOrigins; len(got) != 2 || got[1] != "https://*.example.org" {
+		t.Errorf("Expected origins from CORS_ALLOWED_ORIGINS, got %v", got)
+	}
+	if cfg.CORS.MaxAge != time.Minute {
+		t.Errorf("Expected max age 1m, got %v", cfg.CORS.MaxAge)
+	}
+
+	echo := cfg.CORS.Merge(cfg.CORS.Routes["/echo"])
+	if len(echo.AllowedMethods) != 1 || echo.AllowedMethods[0] != "POST" {
+		t.Errorf("Expected the route to override the methods, got %v", echo.AllowedMethods)
+	}
+	if echo.AllowCredentials == nil || !*echo.AllowCredentials {
+		t.Error("Expected the route to allow credentials")
+	}
+	// Unset route fields are inherited
+	if len(echo.AllowedHeaders) == 0 || echo.MaxAge != time.Minute {
+		t.Errorf("Expected inherited headers and max age, got %v and %v", echo.AllowedHeaders, echo.MaxAge)
+	}
+}
+
+func TestValidateCORS(t *testing.T) {
+	credentials := true
+	cfg := Default()
+	cfg.CORS.AllowedOrigins = []string{"*", "example.com", "https://a.*.example.com"}
+	cfg.CORS.AllowedOriginPatterns = []string{"("}
+	cfg.CORS.AllowCredentials = &credentials
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"allow_credentials", `invalid origin "example.com"`, `invalid origin "https://a.*.example.com"`, "allowed_origin_patterns"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateHSTSPreload(t *testing.T) {
+	cfg := Default()
+	cfg.Security.HSTS.Preload = true
+	cfg.Security.HSTS.MaxAge = time.Hour
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "hsts.preload") {
+		t.Errorf("Expected a preload validation error, got %v", err)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	cfg := Default()
+	cfg.Compression.Encodings = []string{"gzip", "lzma"}
+	cfg.Compression.Level = "max"
+	cfg.Compression.MinSize = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{`unsupported encoding "lzma"`, "compression.level", "compression.min_size"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateRequestBody(t *testing.T) {
+	cfg := Default()
+	cfg.RequestBody.MaxBytes = -1
+	cfg.RequestBody.Routes = map[string]int64{"/echo": -1}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"request_body.max_bytes", "request_body.routes[/echo]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateTimeout(t *testing.T) {
+	cfg := Default()
+	cfg.Server.WriteTimeout = 15 * time.Second
+	cfg.Timeout.Default = 20 * time.Second
+	cfg.Timeout.Routes = map[string]time.Duration{"/echo": -time.Second}
+	cfg.Timeout.Status = 500
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"timeout.default must be shorter than server.write_timeout", "timeout.routes[/echo]", "timeout.status"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidatePrometheus(t *testing.T) {
+	cfg := Default()
+	cfg.Prometheus.DurationBuckets = []float64{0.1, 1, 0.5}
+	cfg.Prometheus.SizeBuckets = nil
+	cfg.Prometheus.MaxEndpoints = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"prometheus.duration_buckets must be in increasing order", "prometheus.size_buckets must not be empty", "prometheus.max_endpoints"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestLoadTelemetryEnv(t *testing.T) {
+	path := writeConfigFile(t, `
+telemetry:
+  otlp_endpoint: collector:4317
+  headers:
+    x-tenant: file
+    x-team: platform
+  resource_attributes:
+    team: platform
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "http/protobuf")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-tenant=env,authorization=Bearer%20token")
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "2500")
+	t.Setenv("OTEL_SERVICE_NAME", "checkout")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.namespace=shop, team=payments")
+	t.Setenv("OTEL_TRACES_SAMPLER", "parentbased_traceidratio")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	t.Setenv("OTEL_PROPAGATORS", "tracecontext,baggage,b3multi")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+
+	tc := cfg.Telemetry
+	if tc.OTLPEndpoint != "http://collector:4318" || tc.Protocol != "http/protobuf" {
+		t.Errorf("Expected the traces protocol to win, got %s over %s", tc.OTLPEndpoint, tc.Protocol)
+	}
+	if tc.Headers["x-tenant"] != "env" || tc.Headers["x-team"] != "platform" || tc.Headers["authorization"] != "Bearer token" {
+		t.Errorf("Expected env headers merged over the file's, got %v", tc.Headers)
+	}
+	if tc.Timeout != 2500*time.Millisecond {
+		t.Errorf("Expected a timeout of 2.5s, got %s", tc.Timeout)
+	}
+	if tc.ServiceName != "checkout" || tc.ResourceAttributes["team"] != "payments" || tc.ResourceAttributes["service.namespace"] != "shop" {
+		t.Errorf("Unexpected resource settings: %s %v", tc.ServiceName, tc.ResourceAttributes)
+	}
+	if tc.Sampler.Type != "parentbased_traceidratio" || tc.Sampler.Arg != 0.25 {
+		t.Errorf("Unexpected sampler: %+v", tc.Sampler)
+	}
+	if strings.Join(tc.Propagators, ",") != "tracecontext,baggage,b3multi" {
+		t.Errorf("Expected propagators tracecontext,baggage,b3multi, got %v", tc.Propagators)
+	}
+	if tc.UseTLS() {
+		t.Error("Expected no TLS for an http endpoint")
+	}
+
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	t.Setenv("OTEL_TRACES_EXPORTER", "console")
+	if cfg, err := Load(nil); err != nil || cfg.Telemetry.Exporter != "none" || len(cfg.Telemetry.Metrics.Exporters) != 0 {
+		t.Errorf("Expected OTEL_SDK_DISABLED to disable tracing and metrics, got %v", err)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "no-value")
+	if _, err := Load(nil); err == nil {
+		t.Error("Expected an error for invalid headers")
+	}
+}
+
+func TestLoadMetricsEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "telemetry:\n  exporter: none\n"))
+	t.Setenv("OTEL_METRICS_EXPORTER", "otlp, console")
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "15000")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() returned an error: %v", err)
+	}
+	mc := cfg.Telemetry.Metrics
+	if strings.Join(mc.Exporters, ",") != "otlp,console" {
+		t.Errorf("Expected exporters otlp,console, got %v", mc.Exporters)
+	}
+	if mc.Interval != 15*time.Second {
+		t.Errorf("Expected an interval of 15s, got %s", mc.Interval)
+	}
+
+	t.Setenv("OTEL_METRICS_EXPORTER", "none")
+	if cfg, err := Load(nil); err != nil || len(cfg.Telemetry.Metrics.Exporters) != 0 {
+		t.Errorf("Expected OTEL_METRICS_EXPORTER=none to disable metrics, got %v", err)
+	}
+
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "1m")
+	if _, err := Load(nil); err == nil {
+		t.Error("Expected an error for an invalid interval")
+	}
+}
+
+func TestValidateTelemetry(t *testing.T) {
+	cfg := Default()
+	cfg.Telemetry.Protocol = "thrift"
+	cfg.Telemetry.OTLPEndpoint = "ftp://collector"
+	cfg.Telemetry.Compression = "zstd"
+	cfg.Telemetry.TLS.CAFile = "ca.pem"
+	cfg.Telemetry.Sampler = SamplerConfig{Type: "parentbased_traceidratio", Arg: 2}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, want := range []string{"telemetry.protocol", "telemetry.otlp_endpoint", "telemetry.compression", "telemetry.tls", "telemetry.sampler.arg"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+
+	cfg = Default()
+	cfg.Telemetry.Exporter = "jaeger"
+	cfg.Telemetry.Sampler.Type = "sometimes"
+	cfg.Telemetry.Metrics = MetricsConfig{Exporters: []string{"prometheus", "statsd"}}
+	cfg.Telemetry.Propagators = []string{"tracecontext", "xray"}
+	err = cfg.Validate()
+	for _, want := range []string{"telemetry.exporter", "telemetry.sampler.type", "telemetry.metrics.exporters", "telemetry.metrics.interval", "telemetry.propagators"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected validation error to mention %s, got: %v", want, err)
+		}
+	}
+}
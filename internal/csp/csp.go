@@ -0,0 +1,140 @@
+// Package csp carries Content-Security-Policy nonces through request
+// contexts and decodes the violation reports browsers send.
+package csp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Content types of violation reports: the report-uri format and the
+// Reporting API format
+const (
+	ContentTypeReport  = "application/csp-report"
+	ContentTypeReports = "application/reports+json"
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the nonce of the request's policy
+func NewContext(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, contextKey{}, nonce)
+}
+
+// Nonce returns the nonce for inline scripts and styles of the response,
+// or "" when the policy has none
+func Nonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(contextKey{}).(string)
+	return nonce
+}
+
+// Report is a Content-Security-Policy violation
+type Report struct {
+	DocumentURI        string
+	BlockedURI         string
+	EffectiveDirective string
+	Disposition        string
+	SourceFile         string
+	LineNumber         int
+}
+
+// legacyReport is the body of an application/csp-report request
+type legacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is one entry of an application/reports+json request
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+	} `json:"body"`
+}
+
+// ParseReports decodes the violation reports in body according to its
+// content type. Reporting API entries other than CSP violations are skipped.
+func ParseReports(contentType string, body []byte) ([]Report, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q", contentType)
+	}
+
+	switch mediaType {
+	case ContentTypeReport, "application/json":
+		var r legacyReport
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, err
+		}
+		directive := r.Report.EffectiveDirective
+		if directive == "" {
+			// Older browsers only send the violated directive with its value
+			directive, _, _ = strings.Cut(r.Report.ViolatedDirective, " ")
+		}
+		return []Report{{
+			DocumentURI:        r.Report.DocumentURI,
+			BlockedURI:         r.Report.BlockedURI,
+			EffectiveDirective: directive,
+			Disposition:        r.Report.Disposition,
+			SourceFile:         r.Report.SourceFile,
+			LineNumber:         r.Report.LineNumber,
+		}}, nil
+	case ContentTypeReports:
+		var entries []reportingAPIReport
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, err
+		}
+		var reports []Report
+		for _, e := range entries {
+			if e.Type != "csp-violation" {
+				continue
+			}
+			reports = append(reports, Report{
+				DocumentURI:        e.Body.DocumentURL,
+				BlockedURI:         e.Body.BlockedURL,
+				EffectiveDirective: e.Body.EffectiveDirective,
+				Disposition:        e.Body.Disposition,
+				SourceFile:         e.Body.SourceFile,
+				LineNumber:         e.Body.LineNumber,
+			})
+		}
+		return reports, nil
+	}
+	return nil, errors.New("unsupported report content type " + mediaType)
+}
+
+// directives are the fetch, document and navigation directives a violation
+// can name; see KnownDirective
+var directives = map[string]bool{
+	"default-src": true, "script-src": true, "script-src-elem": true, "script-src-attr": true,
+	"style-src": true, "style-src-elem": true, "style-src-attr": true, "img-src": true,
+	"font-src": true, "connect-src": true, "media-src": true, "object-src": true,
+	"frame-src": true, "child-src": true, "worker-src": true, "manifest-src": true,
+	"base-uri": true, "form-action": true, "frame-ancestors": true, "sandbox": true,
+	"require-trusted-types-for": true, "trusted-types": true,
+}
+
+// KnownDirective returns directive if it is a CSP directive, and "other"
+// otherwise, so reports cannot create unbounded metric labels
+func KnownDirective(directive string) string {
+	if directives[directive] {
+		return directive
+	}
+	return "other"
+}
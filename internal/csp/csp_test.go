@@ -0,0 +1,73 @@
+package csp
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNonce(t *testing.T) {
+	if got := Nonce(context.Background()); got != "" {
+		t.Errorf("Expected no nonce, got %q", got)
+	}
+	if got := Nonce(NewContext(context.Background(), "abc")); got != "abc" {
+		t.Errorf("Expected nonce abc, got %q", got)
+	}
+}
+
+func TestParseReports(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        []Report
+	}{
+		{
+			"report-uri",
+			"application/csp-report",
+			`{"csp-report": {"document-uri": "https://example.com/docs", "blocked-uri": "inline", "violated-directive": "script-src 'self'", "disposition": "report"}}`,
+			[]Report{{DocumentURI: "https://example.com/docs", BlockedURI: "inline", EffectiveDirective: "script-src", Disposition: "report"}},
+		},
+		{
+			"reporting API",
+			"application/reports+json",
+			`[{"type": "csp-violation", "body": {"documentURL": "https://example.com/", "blockedURL": "https://cdn.test/x.js", "effectiveDirective": "script-src-elem", "disposition": "enforce", "lineNumber": 3}},
+			  {"type": "deprecation", "body": {}}]`,
+			[]Report{{DocumentURI: "https://example.com/", BlockedURI: "https://cdn.test/x.js", EffectiveDirective: "script-src-elem", Disposition: "enforce", LineNumber: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReports(tt.contentType, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseReports() returned an error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d reports, got %d", len(tt.want), len(got))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %+v, got %+v", tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseReportsInvalid(t *testing.T) {
+	if _, err := ParseReports("text/plain", []byte("{}")); err == nil {
+		t.Error("Expected an error for an unsupported content type")
+	}
+	if _, err := ParseReports("application/csp-report", []byte("{")); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestKnownDirective(t *testing.T) {
+	if got := KnownDirective("img-src"); got != "img-src" {
+		t.Errorf("Expected img-src, got %q", got)
+	}
+	if got := KnownDirective("made-up-directive"); got != "other" {
+		t.Errorf("Expected other, got %q", got)
+	}
+}
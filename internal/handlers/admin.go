@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/pkg/models"
+)
+
+// LogLevel handles the admin /admin/log-level endpoint.
+// GET returns the current log level; PUT changes it at runtime from a JSON
+// body such as {"level": "debug"}.
+func (h *Handlers) LogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var body models.LogLevelData
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			apierror.Error(w, r, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		switch level := strings.ToLower(body.Level); level {
+		case "debug", "info", "warn", "error":
+			logging.SetLevel(logging.ParseLevel(level))
+			logging.FromContext(r.Context()).InfoContext(r.Context(), "Log level changed", "level", level)
+		default:
+			problem := apierror.New(http.StatusUnprocessableEntity, "Unsupported log level").
+				WithErrors(apierror.FieldError{Detail: "must be debug, info, warn or error", Pointer: "#/level"})
+			apierror.Write(w, r, problem)
+			return
+		}
+	}
+
+	response := models.Response{
+		Success:   true,
+		Data:      models.LogLevelData{Level: strings.ToLower(logging.Level().String())},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	respond(w, r, http.StatusOK, response)
+}
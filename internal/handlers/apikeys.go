@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/apikey"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyStore returns the API key store, or nil when API keys are disabled
+func (h *Handlers) APIKeyStore() *apikey.Store {
+	return h.apiKeys
+}
+
+// CreateAPIKey handles POST /admin/api-keys. It creates a key from a
+// models.CreateAPIKeyRequest and replies 201 with the plaintext key, which
+// is never shown again.
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var body models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if bodyTooLarge(w, r, err) {
+			return
+		}
+		apierror.Error(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	var fieldErrs []apierror.FieldError
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		fieldErrs = append(fieldErrs, apierror.FieldError{Detail: "must not be empty", Pointer: "#/name"})
+	}
+	var expiresAt *time.Time
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil || d <= 0 {
+			fieldErrs = append(fieldErrs, apierror.FieldError{Detail: "must be a positive duration such as 720h", Pointer: "#/expires_in"})
+		} else {
+			t := time.Now().Add(d).UTC().Truncate(time.Second)
+			expiresAt = &t
+		}
+	}
+	var limit *apikey.RateLimit
+	if body.RateLimit != nil {
+		period, err := time.ParseDuration(body.RateLimit.Period)
+		if body.RateLimit.Requests <= 0 {
+			fieldErrs = append(fieldErrs, apierror.FieldError{Detail: "must be positive", Pointer: "#/rate_limit/requests"})
+		}
+		if err != nil || period <= 0 {
+			fieldErrs = append(fieldErrs, apierror.FieldError{Detail: "must be a positive duration such as 1m", Pointer: "#/rate_limit/period"})
+		}
+		limit = &apikey.RateLimit{Requests: body.RateLimit.Requests, Period: period}
+	}
+	if len(fieldErrs) > 0 {
+		apierror.Write(w, r, apierror.New(http.StatusUnprocessableEntity, "Invalid API key request").WithErrors(fieldErrs...))
+		return
+	}
+
+	key, plaintext, err := h.apiKeys.Create(body.Name, body.Scopes, expiresAt, limit)
+	if err != nil {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "Error creating API key", "error", err)
+		apierror.Error(w, r, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+	logging.FromContext(r.Context()).InfoContext(r.Context(), "API key created", "api_key_id", key.ID, "client", key.Name)
+
+	data := apiKeyData(key)
+	data.Key = plaintext
+	w.Header().Set("Location", "/admin/api-keys/"+key.ID)
+	// The response carries the only copy of the plaintext key
+	w.Header().Set("Cache-Control", "no-store")
+	writeAdminResponse(w, r, http.StatusCreated, data)
+}
+
+// ListAPIKeys handles GET /admin/api-keys, listing every key without secrets
+func (h *Handlers) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys := h.apiKeys.List()
+	data := make([]models.APIKeyData, 0, len(keys))
+	for _, k := range keys {
+		data = append(data, apiKeyData(k))
+	}
+	writeAdminResponse(w, r, http.StatusOK, data)
+}
+
+// RevokeAPIKey handles DELETE /admin/api-keys/{id}. Revoked keys are
+// rejected immediately but stay listed.
+func (h *Handlers) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	key, err := h.apiKeys.Revoke(id)
+	if errors.Is(err, apikey.ErrNotFound) {
+		apierror.Error(w, r, http.StatusNotFound, "API key "+id+" not found")
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "Error revoking API key", "error", err)
+		apierror.Error(w, r, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+	logging.FromContext(r.Context()).InfoContext(r.Context(), "API key revoked", "api_key_id", key.ID, "client", key.Name)
+
+	writeAdminResponse(w, r, http.StatusOK, apiKeyData(key))
+}
+
+func apiKeyData(k apikey.Key) models.APIKeyData {
+	data := models.APIKeyData{
+		ID:        k.ID,
+		Name:      k.Name,
+		Scopes:    k.Scopes,
+		CreatedAt: k.CreatedAt.Format(time.RFC3339),
+	}
+	if data.Scopes == nil {
+		data.Scopes = []string{}
+	}
+	if k.ExpiresAt != nil {
+		data.ExpiresAt = k.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if k.RevokedAt != nil {
+		data.RevokedAt = k.RevokedAt.UTC().Format(time.RFC3339)
+	}
+	if k.RateLimit != nil {
+		data.RateLimit = &models.RateLimitData{Requests: k.RateLimit.Requests, Period: k.RateLimit.Period.String()}
+	}
+	return data
+}
+
+// writeAdminResponse wraps data in the standard response envelope
+func writeAdminResponse(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	response := models.Response{
+		Success:   true,
+		Data:      data,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	respond(w, r, status, response)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/csp"
+	"github.com/dxas90/learn-go/internal/logging"
+)
+
+// maxCSPReportSize bounds the body of a violation report request
+const maxCSPReportSize = 64 << 10
+
+// CSPReport handles the /csp-report endpoint.
+// It accepts violation reports in the application/csp-report and
+// application/reports+json formats, logs them and counts them in the
+// csp_violations_total metric. Replies 204 No Content.
+func (h *Handlers) CSPReport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Error(w, r, http.StatusRequestEntityTooLarge, "Report is too large")
+		return
+	}
+	if err != nil {
+		apierror.Error(w, r, http.StatusBadRequest, "Failed to read report")
+		return
+	}
+
+	reports, err := csp.ParseReports(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		apierror.Error(w, r, http.StatusBadRequest, "Invalid CSP report: "+err.Error())
+		return
+	}
+
+	logger := logging.FromContext(r.Context())
+	for _, report := range reports {
+		disposition := report.Disposition
+		if disposition != "report" {
+			disposition = "enforce"
+		}
+		h.metrics.CSPViolationsTotal.WithLabelValues(csp.KnownDirective(report.EffectiveDirective), disposition).Inc()
+		logger.WarnContext(r.Context(), "Content-Security-Policy violation",
+			"document_uri", report.DocumentURI,
+			"blocked_uri", report.BlockedURI,
+			"directive", report.EffectiveDirective,
+			"disposition", disposition,
+			"source_file", report.SourceFile,
+			"line_number", report.LineNumber,
+		)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,50 +2,100 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/apikey"
 	"github.com/dxas90/learn-go/internal/apispec"
+	"github.com/dxas90/learn-go/internal/buildinfo"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/health"
+	"github.com/dxas90/learn-go/internal/httpcache"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/internal/render"
 	"github.com/dxas90/learn-go/pkg/models"
 	"github.com/shirou/gopsutil/v4/cpu"
-	"github.com/shirou/gopsutil/v4/mem"
-	"github.com/shirou/gopsutil/v4/process"
 	"gopkg.in/yaml.v3"
 )
 
 // Handlers contains all HTTP request handlers for the application
 type Handlers struct {
+	cfg       *config.Config
 	appInfo   models.AppInfo
 	startTime time.Time
+	health    *health.Registry
+	// accepting fails readiness once the server starts shutting down
+	accepting *health.Toggle
+	// started fails the startup probe until the server is listening
+	started *health.Toggle
+	// apiKeys is nil unless API key authentication is enabled
+	apiKeys *apikey.Store
+	metrics *metrics.Metrics
+	// openAPIJSON is the embedded OpenAPI spec converted once at startup
+	openAPIJSON     []byte
+	openAPIJSONETag string
+	openAPIYAMLETag string
+	// versionETags holds the ETag of /version per render format. They are
+	// weak because the responses carry a timestamp.
+	versionETags map[string]string
+	// lastModified is the build time sent as Last-Modified with the ETags,
+	// the same on every replica; zero omits the header
+	lastModified time.Time
 }
 
 // NewHandlers creates a new Handlers instance with application metadata
-// It reads configuration from environment variables and initializes the start time
-func NewHandlers() (*Handlers, error) {
-	version := os.Getenv("APP_VERSION")
-	if version == "" {
-		version = "0.0.1"
+// taken from the given configuration and initializes the start time.
+// m holds the collectors served on /metrics.
+func NewHandlers(cfg *config.Config, m *metrics.Metrics) (*Handlers, error) {
+	slog.Debug("Creating handlers", "version", cfg.App.Version, "environment", cfg.Environment)
+
+	h := &Handlers{
+		cfg: cfg,
+		appInfo: models.AppInfo{
+			Name:        cfg.App.Name,
+			Version:     cfg.App.Version,
+			Environment: cfg.Environment,
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		},
+		startTime:    time.Now(),
+		lastModified: buildinfo.Time(),
+		health:       health.NewRegistry(cfg.Health.CacheTTL),
+		accepting:    health.NewToggle("shutdown", true, "server is shutting down"),
+		started:      health.NewToggle("startup", false, "server has not started yet"),
+		metrics:      m,
 	}
+	h.registerHealthChecks()
 
-	env := os.Getenv("GO_ENV")
-	if env == "" {
-		env = "development"
+	openAPIJSON, err := openAPIToJSON(apispec.OpenAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("converting OpenAPI spec to JSON: %w", err)
+	}
+	h.openAPIJSON = openAPIJSON
+	h.openAPIJSONETag = httpcache.ETag(openAPIJSON)
+	h.openAPIYAMLETag = httpcache.ETag(apispec.OpenAPISpec)
+	version, _ := json.Marshal(h.versionData())
+	h.versionETags = make(map[string]string)
+	for _, f := range render.Formats() {
+		h.versionETags[f.Name] = httpcache.WeakETag(append(version, f.Name...))
 	}
 
-	log.Printf("Creating handlers with version=%s, env=%s", version, env)
+	if cfg.APIKeys.Enabled {
+		keys, err := apikey.NewStore(cfg.APIKeys.File)
+		if err != nil {
+			return nil, err
+		}
+		h.apiKeys = keys
+	}
 
-	return &Handlers{
-		appInfo: models.AppInfo{
-			Name:        "learn-go",
-			Version:     version,
-			Environment: env,
-			Timestamp:   time.Now().UTC().Format(time.RFC3339),
-		},
-		startTime: time.Now(),
-	}, nil
+	return h, nil
 }
 
 // Index handles the root endpoint (/)
@@ -68,6 +118,9 @@ func (h *Handlers) Index(w http.ResponseWriter, r *http.Request) {
 				{Path: "/", Method: "GET", Description: "API welcome and documentation"},
 				{Path: "/ping", Method: "GET", Description: "Simple ping-pong response"},
 				{Path: "/healthz", Method: "GET", Description: "Health check endpoint"},
+				{Path: "/livez", Method: "GET", Description: "Liveness probe"},
+				{Path: "/readyz", Method: "GET", Description: "Readiness probe"},
+				{Path: "/startupz", Method: "GET", Description: "Startup probe"},
 				{Path: "/info", Method: "GET", Description: "Application and system information"},
 				{Path: "/version", Method: "GET", Description: "Application version information"},
 				{Path: "/echo", Method: "POST", Description: "Echo back the request body"},
@@ -79,8 +132,7 @@ func (h *Handlers) Index(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusOK, response)
 }
 
 // Ping handles the /ping endpoint
@@ -91,46 +143,26 @@ func (h *Handlers) Ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("pong"))
 }
 
-// Healthz handles the /healthz endpoint
-// Returns detailed health information including memory usage and uptime
-func (h *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
-	p, _ := process.NewProcess(int32(os.Getpid()))
-	memInfo, _ := p.MemoryInfo()
-	virtualMem, _ := mem.VirtualMemory()
-
-	uptime := time.Since(h.startTime).Seconds()
-
-	response := models.Response{
-		Success: true,
-		Data: models.HealthData{
-			Status:    "healthy",
-			Uptime:    uptime,
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-			Memory: models.MemoryInfo{
-				RSS:       memInfo.RSS,
-				VMS:       memInfo.VMS,
-				Percent:   memInfo.RSS * 100 / virtualMem.Total,
-				Available: virtualMem.Available,
-				Total:     virtualMem.Total,
-			},
-			Version:     h.appInfo.Version,
-			Environment: h.appInfo.Environment,
-		},
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
-
 // Info handles the /info endpoint
-// Returns comprehensive system and runtime information including CPU, memory, and process details
+// Returns comprehensive system and runtime information including CPU, memory, and process details.
+// It samples CPU usage for 100ms and returns without a response if the request context ends first.
 func (h *Handlers) Info(w http.ResponseWriter, r *http.Request) {
-	p, _ := process.NewProcess(int32(os.Getpid()))
-	memInfo, _ := p.MemoryInfo()
-	virtualMem, _ := mem.VirtualMemory()
-	cpuPercent, _ := cpu.Percent(time.Millisecond*100, false)
-	cpuCount, _ := cpu.Counts(true)
+	memory, err := readMemoryInfo()
+	if err != nil {
+		logging.FromContext(r.Context()).WarnContext(r.Context(), "Error reading memory information", "error", err)
+	}
+	var cpuInfo models.CPUInfo
+	cpuPercent, err := cpu.PercentWithContext(r.Context(), time.Millisecond*100, false)
+	if err != nil && r.Context().Err() != nil {
+		// The request timed out or the client went away while sampling
+		return
+	}
+	if err == nil && len(cpuPercent) > 0 {
+		cpuInfo.Percent = cpuPercent[0]
+	} else if err != nil {
+		logging.FromContext(r.Context()).WarnContext(r.Context(), "Error reading CPU usage", "error", err)
+	}
+	cpuInfo.Count, _ = cpu.Counts(true)
 
 	response := models.Response{
 		Success: true,
@@ -144,64 +176,60 @@ func (h *Handlers) Info(w http.ResponseWriter, r *http.Request) {
 				Processor:       "", // Not easily available in Go
 				GoVersion:       runtime.Version(),
 				Uptime:          time.Since(h.startTime).Seconds(),
-				Memory: models.MemoryInfo{
-					RSS:       memInfo.RSS,
-					VMS:       memInfo.VMS,
-					Percent:   memInfo.RSS * 100 / virtualMem.Total,
-					Available: virtualMem.Available,
-					Total:     virtualMem.Total,
-					Used:      virtualMem.Used,
-				},
-				CPU: models.CPUInfo{
-					Count:   cpuCount,
-					Percent: cpuPercent[0],
-				},
+				Memory:          memory,
+				CPU:             cpuInfo,
 			},
 			Environment: models.EnvironmentInfo{
-				GoEnv: os.Getenv("GO_ENV"),
-				Port:  os.Getenv("PORT"),
-				Host:  os.Getenv("HOST"),
+				GoEnv: h.cfg.Environment,
+				Port:  strconv.Itoa(h.cfg.Server.Port),
+				Host:  h.cfg.Server.Host,
 			},
 		},
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusOK, response)
 }
 
 // Version handles the /version endpoint
 // Returns application version and environment information
+// Replies 304 Not Modified when the client's copy is current.
 func (h *Handlers) Version(w http.ResponseWriter, r *http.Request) {
+	if f, err := render.Negotiate(r); err == nil {
+		w.Header().Add("Vary", "Accept")
+		if httpcache.NotModified(w, r, h.versionETags[f.Name], h.lastModified) {
+			return
+		}
+	}
 	response := models.Response{
-		Success: true,
-		Data: models.VersionData{
-			Version:     h.appInfo.Version,
-			Name:        h.appInfo.Name,
-			Environment: h.appInfo.Environment,
-		},
+		Success:   true,
+		Data:      h.versionData(),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusOK, response)
+}
+
+func (h *Handlers) versionData() models.VersionData {
+	return models.VersionData{
+		Version:     h.appInfo.Version,
+		Name:        h.appInfo.Name,
+		Environment: h.appInfo.Environment,
+	}
 }
 
 // Echo handles the /echo endpoint
 // Accepts JSON in the request body and echoes it back along with request metadata
-// Returns a 400 Bad Request if the JSON payload is invalid
+// Returns a 400 Bad Request problem if the JSON payload is invalid
 func (h *Handlers) Echo(w http.ResponseWriter, r *http.Request) {
 	var data interface{}
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		response := models.ErrorResponse{
-			Error:      true,
-			Message:    "Invalid JSON",
-			StatusCode: 400,
-			Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		if bodyTooLarge(w, r, err) {
+			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		problem := apierror.New(http.StatusBadRequest, "Invalid JSON").
+			WithErrors(apierror.FieldError{Detail: err.Error(), Pointer: "#"})
+		apierror.Write(w, r, problem)
 		return
 	}
 
@@ -222,35 +250,62 @@ func (h *Handlers) Echo(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	respond(w, r, http.StatusOK, response)
 }
 
-// OpenAPISpec handles the /openapi.json endpoint
-// Returns the embedded OpenAPI YAML spec converted to JSON
-func (h *Handlers) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
-	// Convert embedded YAML to JSON
-	var yamlData interface{}
-	if err := yaml.Unmarshal(apispec.OpenAPISpec, &yamlData); err != nil {
-		log.Printf("Error parsing OpenAPI spec: %v", err)
-		http.Error(w, "Failed to parse OpenAPI spec", http.StatusInternalServerError)
-		return
+// respond sends v with status in the format negotiated for r (see package
+// render), or a 406 Not Acceptable problem when the client accepts none
+func respond(w http.ResponseWriter, r *http.Request, status int, v any) {
+	err := render.Write(w, r, status, v)
+	switch {
+	case errors.Is(err, render.ErrNotAcceptable):
+		apierror.Error(w, r, http.StatusNotAcceptable,
+			"Supported media types are "+strings.Join(render.MediaTypes(), ", "))
+	case err != nil:
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "Error rendering response", "error", err)
+		apierror.Error(w, r, http.StatusInternalServerError, "")
 	}
+}
 
-	jsonData, err := json.Marshal(yamlData)
-	if err != nil {
-		log.Printf("Error converting OpenAPI spec to JSON: %v", err)
-		http.Error(w, "Failed to convert OpenAPI spec to JSON", http.StatusInternalServerError)
-		return
+// bodyTooLarge replies with 413 Content Too Large and returns true when err
+// comes from reading past the request body limit (see http.MaxBytesReader)
+func bodyTooLarge(w http.ResponseWriter, r *http.Request, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
 	}
+	apierror.Error(w, r, http.StatusRequestEntityTooLarge,
+		fmt.Sprintf("Request body exceeds the limit of %d bytes", tooLarge.Limit))
+	return true
+}
 
+// OpenAPISpec handles the /openapi.json endpoint
+// Returns the embedded OpenAPI YAML spec converted to JSON at startup,
+// or 304 Not Modified when the client's copy is current
+func (h *Handlers) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	if httpcache.NotModified(w, r, h.openAPIJSONETag, h.lastModified) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonData)
+	w.Write(h.openAPIJSON)
 }
 
 // OpenAPISpecYAML handles the /openapi.yaml endpoint
-// Returns the embedded OpenAPI spec in YAML format
+// Returns the embedded OpenAPI spec in YAML format, or 304 Not Modified when
+// the client's copy is current
 func (h *Handlers) OpenAPISpecYAML(w http.ResponseWriter, r *http.Request) {
+	if httpcache.NotModified(w, r, h.openAPIYAMLETag, h.lastModified) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/x-yaml")
 	w.Write(apispec.OpenAPISpec)
 }
+
+// openAPIToJSON converts the YAML OpenAPI spec to JSON
+func openAPIToJSON(spec []byte) ([]byte, error) {
+	var data interface{}
+	if err := yaml.Unmarshal(spec, &data); err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
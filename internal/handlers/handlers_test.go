@@ -1,17 +1,40 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/buildinfo"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/pkg/models"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
+// testConfig returns the default configuration with the test environment set
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Environment = "test"
+	return cfg
+}
+
+// testMetrics returns collectors registered with a registry of their own
+func testMetrics() *metrics.Metrics {
+	return metrics.New(config.Default().Prometheus, prometheus.NewRegistry())
+}
+
 func TestPing(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
@@ -36,8 +59,7 @@ func TestPing(t *testing.T) {
 }
 
 func TestHealthz(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
@@ -70,9 +92,88 @@ func TestHealthz(t *testing.T) {
 	}
 }
 
+func TestHealthzNotReady(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+	h.SetReady(false)
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+
+	h.Healthz(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	data, ok := response["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected data object")
+	}
+
+	if status, ok := data["status"].(string); !ok || status != "shutting_down" {
+		t.Errorf("Expected status='shutting_down', got %v", data["status"])
+	}
+}
+
+func TestProbes(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		setup   func()
+		want    int
+	}{
+		{"livez", h.Livez, func() {}, http.StatusOK},
+		{"readyz", h.Readyz, func() {}, http.StatusOK},
+		{"startupz before start", h.Startupz, func() {}, http.StatusServiceUnavailable},
+		{"startupz after start", h.Startupz, func() { h.SetStarted(true) }, http.StatusOK},
+		{"readyz during shutdown", h.Readyz, func() { h.SetReady(false) }, http.StatusServiceUnavailable},
+		{"livez during shutdown", h.Livez, func() {}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+
+			tt.handler(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+
+			data, ok := response["data"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("Expected data object")
+			}
+			if _, ok := data["checks"].([]interface{}); !ok {
+				t.Errorf("Expected per-check results, got %v", data["checks"])
+			}
+		})
+	}
+}
+
 func TestVersion(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
@@ -101,9 +202,133 @@ func TestVersion(t *testing.T) {
 	}
 }
 
+func TestVersionNegotiation(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"application/yaml", http.StatusOK, "application/yaml"},
+		{"application/xml", http.StatusOK, "application/xml"},
+		{"application/cbor", http.StatusOK, "application/cbor"},
+		{"application/msgpack", http.StatusOK, "application/msgpack"},
+		{"text/html", http.StatusNotAcceptable, "application/problem+json"},
+	}
+
+	etags := make(map[string]bool)
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/version", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+
+		h.Version(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("Accept %q: expected status %d, got %d", tt.accept, tt.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("Accept %q: expected Content-Type %s, got %q", tt.accept, tt.contentType, ct)
+		}
+		if w.Code == http.StatusOK {
+			etags[w.Header().Get("ETag")] = true
+		}
+	}
+	if len(etags) != len(tests)-1 {
+		t.Errorf("Expected a distinct ETag per format, got %v", etags)
+	}
+
+	req := httptest.NewRequest("GET", "/version?format=yaml", nil)
+	w := httptest.NewRecorder()
+	h.Version(w, req)
+	if !strings.Contains(w.Body.String(), "name: learn-go") {
+		t.Errorf("Expected a YAML body, got %s", w.Body.String())
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.OpenAPISpec(w, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if _, ok := spec["openapi"].(string); !ok {
+		t.Errorf("Expected the openapi version field, got %v", spec["openapi"])
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	defer func(ts string) { buildinfo.Timestamp = ts }(buildinfo.Timestamp)
+	buildinfo.Timestamp = "2024-01-02T15:04:05Z"
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/version", h.Version},
+		{"/openapi.json", h.OpenAPISpec},
+		{"/openapi.yaml", h.OpenAPISpecYAML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest("GET", tt.path, nil))
+			etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+			if etag == "" || lastModified != "Tue, 02 Jan 2024 15:04:05 GMT" {
+				t.Fatalf("Expected ETag and the build time as Last-Modified, got %v", w.Header())
+			}
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+				t.Errorf("Expected an empty 304 for If-None-Match, got %d with %d bytes", w.Code, w.Body.Len())
+			}
+
+			req = httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("If-Modified-Since", lastModified)
+			w = httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != http.StatusNotModified {
+				t.Errorf("Expected status 304 for If-Modified-Since, got %d", w.Code)
+			}
+
+			req = httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("If-None-Match", `"stale"`)
+			w = httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status 200 for a stale ETag, got %d", w.Code)
+			}
+		})
+	}
+}
+
 func TestEcho(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
@@ -150,15 +375,78 @@ func TestEcho(t *testing.T) {
 	}
 }
 
+func TestEchoBodyTooLarge(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader(`{"message":"`+strings.Repeat("a", 100)+`"}`))
+	w := httptest.NewRecorder()
+	req.Body = http.MaxBytesReader(w, req.Body, 64)
+
+	h.Echo(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "limit of 64 bytes") {
+		t.Errorf("Expected the limit in the problem detail, got %s", w.Body.String())
+	}
+}
+
 func TestEchoInvalidJSON(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader("invalid json"))
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-42"))
+	w := httptest.NewRecorder()
+
+	h.Echo(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected problem content type, got %q", ct)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	if response["status"] != float64(400) || response["title"] != "Bad Request" {
+		t.Errorf("Unexpected problem: %v", response)
+	}
+	if response["detail"] != "Invalid JSON" {
+		t.Errorf("Expected detail='Invalid JSON', got %v", response["detail"])
+	}
+	if response["instance"] != "/echo" {
+		t.Errorf("Expected instance='/echo', got %v", response["instance"])
+	}
+	if requestID, ok := response["requestId"].(string); !ok || requestID != "req-42" {
+		t.Errorf("Expected requestId='req-42', got %v", response["requestId"])
+	}
+	if errs, ok := response["errors"].([]interface{}); !ok || len(errs) != 1 {
+		t.Errorf("Expected one validation error, got %v", response["errors"])
+	}
+}
+
+func TestEchoInvalidJSONLegacy(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
 
 	req := httptest.NewRequest("POST", "/echo", strings.NewReader("invalid json"))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req = req.WithContext(logging.WithRequestID(req.Context(), "req-42"))
 	w := httptest.NewRecorder()
 
 	h.Echo(w, req)
@@ -166,6 +454,9 @@ func TestEchoInvalidJSON(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
 
 	var response map[string]interface{}
 	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
@@ -179,11 +470,14 @@ func TestEchoInvalidJSON(t *testing.T) {
 	if message, ok := response["message"].(string); !ok || message != "Invalid JSON" {
 		t.Errorf("Expected message='Invalid JSON', got %v", response["message"])
 	}
+
+	if requestID, ok := response["requestId"].(string); !ok || requestID != "req-42" {
+		t.Errorf("Expected requestId='req-42', got %v", response["requestId"])
+	}
 }
 
 func TestIndexEndpoint(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
@@ -217,8 +511,7 @@ func TestIndexEndpoint(t *testing.T) {
 }
 
 func TestInfoEndpoint(t *testing.T) {
-	os.Setenv("GO_ENV", "test")
-	h, err := NewHandlers()
+	h, err := NewHandlers(testConfig(), testMetrics())
 	if err != nil {
 		t.Fatalf("Failed to create handlers: %v", err)
 	}
@@ -250,3 +543,179 @@ func TestInfoEndpoint(t *testing.T) {
 		t.Errorf("Expected system field")
 	}
 }
+
+func TestInfoCanceled(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/info", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	h.Info(w, req)
+
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("Expected Info to stop sampling CPU once the context ended, took %s", elapsed)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no response for a canceled request, got %s", w.Body.String())
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+	defer logging.SetLevel(logging.Level())
+
+	req := httptest.NewRequest("PUT", "/admin/log-level", strings.NewReader(`{"level": "debug"}`))
+	w := httptest.NewRecorder()
+	h.LogLevel(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if logging.Level() != slog.LevelDebug {
+		t.Errorf("Expected level debug, got %v", logging.Level())
+	}
+
+	var response models.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if data, ok := response.Data.(map[string]interface{}); !ok || data["level"] != "debug" {
+		t.Errorf("Expected level=debug in response, got %v", response.Data)
+	}
+
+	req = httptest.NewRequest("PUT", "/admin/log-level", strings.NewReader(`{"level": "verbose"}`))
+	w = httptest.NewRecorder()
+	h.LogLevel(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
+	}
+	if logging.Level() != slog.LevelDebug {
+		t.Errorf("Expected an invalid level to be ignored, got %v", logging.Level())
+	}
+}
+
+func TestAPIKeyAdmin(t *testing.T) {
+	cfg := testConfig()
+	cfg.APIKeys.Enabled = true
+	cfg.APIKeys.File = filepath.Join(t.TempDir(), "api-keys.json")
+	h, err := NewHandlers(cfg, testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	body := `{"name": "billing", "scopes": ["echo:write"], "expires_in": "24h", "rate_limit": {"requests": 10, "period": "1m"}}`
+	w := httptest.NewRecorder()
+	h.CreateAPIKey(w, httptest.NewRequest("POST", "/admin/api-keys", strings.NewReader(body)))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("Expected the created key not to be cached")
+	}
+	var created struct {
+		Data models.APIKeyData `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if created.Data.Key == "" || created.Data.ExpiresAt == "" || created.Data.RateLimit.Period != "1m0s" {
+		t.Errorf("Unexpected created key: %+v", created.Data)
+	}
+	if _, err := h.APIKeyStore().Authenticate(created.Data.Key); err != nil {
+		t.Errorf("Expected the returned key to authenticate, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	h.ListAPIKeys(w, httptest.NewRequest("GET", "/admin/api-keys", nil))
+	if strings.Contains(w.Body.String(), created.Data.Key) || strings.Contains(w.Body.String(), `"key"`) {
+		t.Errorf("Expected listed keys not to include the plaintext, got %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), created.Data.ID) {
+		t.Errorf("Expected the key to be listed, got %s", w.Body.String())
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/admin/api-keys/"+created.Data.ID, nil), map[string]string{"id": created.Data.ID})
+	w = httptest.NewRecorder()
+	h.RevokeAPIKey(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "revoked_at") {
+		t.Errorf("Expected the key to be revoked, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest("DELETE", "/admin/api-keys/missing", nil), map[string]string{"id": "missing"})
+	w = httptest.NewRecorder()
+	h.RevokeAPIKey(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestCreateAPIKeyInvalid(t *testing.T) {
+	cfg := testConfig()
+	cfg.APIKeys.Enabled = true
+	cfg.APIKeys.File = filepath.Join(t.TempDir(), "api-keys.json")
+	h, err := NewHandlers(cfg, testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+
+	body := `{"name": " ", "expires_in": "soon", "rate_limit": {"requests": 0, "period": "1m"}}`
+	w := httptest.NewRecorder()
+	h.CreateAPIKey(w, httptest.NewRequest("POST", "/admin/api-keys", strings.NewReader(body)))
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", w.Code)
+	}
+	for _, pointer := range []string{"#/name", "#/expires_in", "#/rate_limit/requests"} {
+		if !strings.Contains(w.Body.String(), pointer) {
+			t.Errorf("Expected an error for %s, got %s", pointer, w.Body.String())
+		}
+	}
+}
+
+func TestCSPReport(t *testing.T) {
+	h, err := NewHandlers(testConfig(), testMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create handlers: %v", err)
+	}
+	counter := h.metrics.CSPViolationsTotal.WithLabelValues("script-src", "report")
+
+	body := `{"csp-report": {"document-uri": "https://example.com/", "blocked-uri": "inline", "effective-directive": "script-src", "disposition": "report"}}`
+	req := httptest.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/csp-report")
+	w := httptest.NewRecorder()
+	h.CSPReport(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+	if got := testutil.ToFloat64(counter); got != 1 {
+		t.Errorf("Expected one violation to be counted, got %v", got)
+	}
+
+	req = httptest.NewRequest("POST", "/csp-report", strings.NewReader(strings.Repeat("x", maxCSPReportSize+1)))
+	req.Header.Set("Content-Type", "application/csp-report")
+	w = httptest.NewRecorder()
+	h.CSPReport(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/csp-report", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	h.CSPReport(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
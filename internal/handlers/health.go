@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/health"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/pkg/models"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// registerHealthChecks registers the built-in checks for each probe kind
+func (h *Handlers) registerHealthChecks() {
+	memory := health.NewMemoryChecker(h.cfg.Health.MemoryThresholdPercent)
+
+	h.health.Register(memory, health.Liveness, health.Readiness)
+	h.health.Register(h.accepting, health.Readiness)
+	h.health.Register(h.started, health.Startup)
+}
+
+// Health returns the health check registry so that other components can
+// register their own checks
+func (h *Handlers) Health() *health.Registry {
+	return h.health
+}
+
+// SetReady marks the application as ready or not ready to receive traffic.
+// The server clears it when shutting down so readiness starts failing
+// before connections are drained.
+func (h *Handlers) SetReady(ready bool) {
+	h.accepting.Set(ready)
+}
+
+// SetStarted marks the application as started once the server is listening,
+// which makes the startup probe pass
+func (h *Handlers) SetStarted(started bool) {
+	h.started.Set(started)
+}
+
+// Healthz handles the /healthz endpoint
+// Returns detailed health information including memory usage and uptime.
+// Responds with 503 Service Unavailable when a critical readiness check
+// fails, including once the server is shutting down.
+func (h *Handlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Run(r.Context(), health.Readiness)
+
+	status, statusCode := "healthy", http.StatusOK
+	switch {
+	case !h.accepting.OK():
+		status, statusCode = "shutting_down", http.StatusServiceUnavailable
+	case !report.Healthy():
+		status, statusCode = "unhealthy", http.StatusServiceUnavailable
+	}
+
+	memory, err := readMemoryInfo()
+	if err != nil {
+		logging.FromContext(r.Context()).WarnContext(r.Context(), "Error reading memory information", "error", err)
+	}
+
+	response := models.Response{
+		Success: statusCode == http.StatusOK,
+		Data: models.HealthData{
+			Status:      status,
+			Uptime:      time.Since(h.startTime).Seconds(),
+			Timestamp:   time.Now().UTC().Format(time.RFC3339),
+			Memory:      memory,
+			Version:     h.appInfo.Version,
+			Environment: h.appInfo.Environment,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	respond(w, r, statusCode, response)
+}
+
+// Livez handles the /livez endpoint
+// Returns 503 when a critical liveness check fails and the process should be restarted
+func (h *Handlers) Livez(w http.ResponseWriter, r *http.Request) {
+	h.probe(w, r, health.Liveness)
+}
+
+// Readyz handles the /readyz endpoint
+// Returns 503 when a critical readiness check fails and the process should not receive traffic
+func (h *Handlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	h.probe(w, r, health.Readiness)
+}
+
+// Startupz handles the /startupz endpoint
+// Returns 503 until the application has finished starting
+func (h *Handlers) Startupz(w http.ResponseWriter, r *http.Request) {
+	h.probe(w, r, health.Startup)
+}
+
+// probe runs the checks of the given kind and writes the per-check results
+func (h *Handlers) probe(w http.ResponseWriter, r *http.Request, kind health.Kind) {
+	report := h.health.Run(r.Context(), kind)
+
+	statusCode := http.StatusOK
+	if !report.Healthy() {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	response := models.Response{
+		Success:   report.Healthy(),
+		Data:      report,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respond(w, r, statusCode, response)
+}
+
+// readMemoryInfo collects process and system memory statistics.
+// Fields that cannot be read are left at zero and the error is returned.
+func readMemoryInfo() (models.MemoryInfo, error) {
+	var info models.MemoryInfo
+
+	virtualMem, err := mem.VirtualMemory()
+	if err != nil {
+		return info, err
+	}
+	info.Available = virtualMem.Available
+	info.Total = virtualMem.Total
+	info.Used = virtualMem.Used
+
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return info, err
+	}
+	memInfo, err := p.MemoryInfo()
+	if err != nil {
+		return info, err
+	}
+	info.RSS = memInfo.RSS
+	info.VMS = memInfo.VMS
+	if virtualMem.Total > 0 {
+		info.Percent = memInfo.RSS * 100 / virtualMem.Total
+	}
+	return info, nil
+}
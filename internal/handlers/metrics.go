@@ -2,39 +2,9 @@ package handlers
 
 import (
 	"net/http"
-
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-)
-
-var (
-	// HTTPRequestsTotal counts total HTTP requests by method, endpoint, and status
-	HTTPRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-
-	// HTTPRequestDuration measures HTTP request duration in seconds
-	HTTPRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
 )
 
-func init() {
-	// Register metrics with Prometheus
-	prometheus.MustRegister(HTTPRequestsTotal)
-	prometheus.MustRegister(HTTPRequestDuration)
-}
-
-// Metrics returns the Prometheus metrics handler
+// Metrics serves the collectors of the metrics registry
 func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
-	promhttp.Handler().ServeHTTP(w, r)
+	h.metrics.Handler().ServeHTTP(w, r)
 }
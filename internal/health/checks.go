@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// Toggle is a critical Checker whose state is set explicitly, for example
+// to report that startup has completed or that shutdown has begun
+type Toggle struct {
+	name   string
+	reason string
+	ok     atomic.Bool
+}
+
+// NewToggle creates a Toggle in the given initial state.
+// reason is reported as the error while the toggle is off.
+func NewToggle(name string, ok bool, reason string) *Toggle {
+	t := &Toggle{name: name, reason: reason}
+	t.ok.Store(ok)
+	return t
+}
+
+// Set changes the state of the toggle
+func (t *Toggle) Set(ok bool) {
+	t.ok.Store(ok)
+}
+
+// OK reports the current state of the toggle
+func (t *Toggle) OK() bool {
+	return t.ok.Load()
+}
+
+func (t *Toggle) Name() string           { return t.name }
+func (t *Toggle) Timeout() time.Duration { return 0 }
+func (t *Toggle) Critical() bool         { return true }
+
+// Uncached makes the registry evaluate the toggle on every probe
+func (t *Toggle) Uncached() bool { return true }
+
+// Check fails while the toggle is off
+func (t *Toggle) Check(ctx context.Context) error {
+	if !t.ok.Load() {
+		return errors.New(t.reason)
+	}
+	return nil
+}
+
+// NewMemoryChecker returns a non-critical check that fails when system
+// memory cannot be read or the process resident set exceeds maxPercent of
+// total memory. A maxPercent of zero only checks that memory can be read.
+func NewMemoryChecker(maxPercent float64) Checker {
+	return NewChecker("memory", 2*time.Second, false, func(ctx context.Context) error {
+		virtualMem, err := mem.VirtualMemoryWithContext(ctx)
+		if err != nil {
+			return fmt.Errorf("reading system memory: %w", err)
+		}
+
+		p, err := process.NewProcessWithContext(ctx, int32(os.Getpid()))
+		if err != nil {
+			return fmt.Errorf("reading process: %w", err)
+		}
+		memInfo, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			return fmt.Errorf("reading process memory: %w", err)
+		}
+
+		if maxPercent > 0 && virtualMem.Total > 0 {
+			percent := float64(memInfo.RSS) * 100 / float64(virtualMem.Total)
+			if percent > maxPercent {
+				return fmt.Errorf("process uses %.1f%% of system memory (limit %.1f%%)", percent, maxPercent)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,275 @@
+// Package health implements liveness, readiness and startup checks.
+//
+// Checks implement the Checker interface and are registered on a Registry
+// for one or more probe kinds. The registry runs the checks of a kind
+// concurrently, each bounded by its own timeout, and caches results for a
+// short time so that frequent probes do not overload dependencies.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Kind identifies the probe a check belongs to
+type Kind string
+
+const (
+	// Liveness checks fail when the process must be restarted
+	Liveness Kind = "liveness"
+	// Readiness checks fail when the process must not receive traffic
+	Readiness Kind = "readiness"
+	// Startup checks fail until the process has finished initializing
+	Startup Kind = "startup"
+)
+
+// Check statuses reported in results
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// Checker is a single health check
+type Checker interface {
+	// Name identifies the check in reports
+	Name() string
+	// Timeout bounds how long Check may run
+	Timeout() time.Duration
+	// Critical reports whether a failure fails the whole probe.
+	// Failures of non-critical checks only degrade the status to "warn".
+	Critical() bool
+	// Check returns nil when healthy
+	Check(ctx context.Context) error
+}
+
+// CheckFunc is the function signature used by NewChecker
+type CheckFunc func(ctx context.Context) error
+
+type funcChecker struct {
+	name     string
+	timeout  time.Duration
+	critical bool
+	fn       CheckFunc
+}
+
+// NewChecker creates a Checker from a function
+func NewChecker(name string, timeout time.Duration, critical bool, fn CheckFunc) Checker {
+	return &funcChecker{name: name, timeout: timeout, critical: critical, fn: fn}
+}
+
+func (c *funcChecker) Name() string                    { return c.name }
+func (c *funcChecker) Timeout() time.Duration          { return c.timeout }
+func (c *funcChecker) Critical() bool                  { return c.critical }
+func (c *funcChecker) Check(ctx context.Context) error { return c.fn(ctx) }
+
+// Result is the outcome of a single check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	Error     string  `json:"error,omitempty"`
+	Duration  float64 `json:"duration_ms"`
+	CheckedAt string  `json:"checked_at"`
+}
+
+// Report is the aggregated outcome of all checks of a kind
+type Report struct {
+	Kind   Kind     `json:"kind"`
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Healthy reports whether no critical check failed
+func (r Report) Healthy() bool {
+	return r.Status != StatusFail
+}
+
+type cachedResult struct {
+	result  Result
+	expires time.Time
+}
+
+// pendingResult is a detached run of a check shared by concurrent probes;
+// result is set before done is closed
+type pendingResult struct {
+	done   chan struct{}
+	result Result
+}
+
+// Registry holds the registered checks and their cached results
+type Registry struct {
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	checks   map[Kind][]Checker
+	cache    map[Checker]cachedResult
+	inflight map[Checker]*pendingResult
+	started  bool
+}
+
+// NewRegistry creates an empty Registry. Results are reused for cacheTTL;
+// a zero TTL disables caching.
+func NewRegistry(cacheTTL time.Duration) *Registry {
+	return &Registry{
+		cacheTTL: cacheTTL,
+		checks:   make(map[Kind][]Checker),
+		cache:    make(map[Checker]cachedResult),
+		inflight: make(map[Checker]*pendingResult),
+	}
+}
+
+// Register adds a check to the given probe kinds
+func (r *Registry) Register(c Checker, kinds ...Kind) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range kinds {
+		r.checks[k] = append(r.checks[k], c)
+	}
+}
+
+// Run executes the checks registered for kind concurrently and aggregates
+// their results. Once the startup probe has passed it keeps passing, as
+// startup only happens once per process.
+func (r *Registry) Run(ctx context.Context, kind Kind) Report {
+	r.mu.Lock()
+	checks := append([]Checker(nil), r.checks[kind]...)
+	startedAlready := kind == Startup && r.started
+	r.mu.Unlock()
+
+	report := Report{Kind: kind, Status: StatusPass, Checks: make([]Result, len(checks))}
+	if startedAlready {
+		report.Checks = []Result{}
+		return report
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Checker) {
+			defer wg.Done()
+			report.Checks[i] = r.runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		switch {
+		case res.Status == StatusFail && res.Critical:
+			report.Status = StatusFail
+		case res.Status == StatusFail && report.Status == StatusPass:
+			report.Status = StatusWarn
+		}
+	}
+
+	if kind == Startup && report.Healthy() {
+		r.mu.Lock()
+		r.started = true
+		r.mu.Unlock()
+	}
+	return report
+}
+
+// Uncached can be implemented by checks that are cheap and must always
+// reflect the current state, such as Toggle
+type Uncached interface {
+	Uncached() bool
+}
+
+// runCheck returns the cached result of c or runs it with its timeout
+func (r *Registry) runCheck(ctx context.Context, c Checker) Result {
+	now := time.Now()
+
+	if u, ok := c.(Uncached); ok && u.Uncached() {
+		return r.execute(ctx, c, now)
+	}
+
+	r.mu.Lock()
+	if cached, ok := r.cache[c]; ok && now.Before(cached.expires) {
+		r.mu.Unlock()
+		return cached.result
+	}
+
+	// Checks without a timeout of their own end with the caller, and such
+	// failures are not cached
+	if c.Timeout() <= 0 {
+		r.mu.Unlock()
+		res := r.execute(ctx, c, now)
+		if r.cacheTTL > 0 && (res.Status == StatusPass || ctx.Err() == nil) {
+			r.mu.Lock()
+			r.cache[c] = cachedResult{result: res, expires: now.Add(r.cacheTTL)}
+			r.mu.Unlock()
+		}
+		return res
+	}
+
+	// Other results are shared by every probe, so the check runs detached
+	// from the caller, who may go away, and concurrent probes wait for the
+	// same run instead of starting their own
+	if pending, ok := r.inflight[c]; ok {
+		r.mu.Unlock()
+		<-pending.done
+		return pending.result
+	}
+	pending := &pendingResult{done: make(chan struct{})}
+	r.inflight[c] = pending
+	r.mu.Unlock()
+
+	pending.result = r.execute(context.WithoutCancel(ctx), c, now)
+
+	r.mu.Lock()
+	delete(r.inflight, c)
+	if r.cacheTTL > 0 {
+		r.cache[c] = cachedResult{result: pending.result, expires: now.Add(r.cacheTTL)}
+	}
+	r.mu.Unlock()
+	close(pending.done)
+	return pending.result
+}
+
+// execute runs c bounded by its timeout and converts the outcome to a Result
+func (r *Registry) execute(ctx context.Context, c Checker, now time.Time) Result {
+	if timeout := c.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := runWithContext(ctx, c)
+
+	res := Result{
+		Name:      c.Name(),
+		Status:    StatusPass,
+		Critical:  c.Critical(),
+		Duration:  float64(time.Since(now).Microseconds()) / 1000,
+		CheckedAt: now.UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// runWithContext runs the check and stops waiting for it once ctx is done,
+// so a check ignoring its context cannot block the probe
+func runWithContext(ctx context.Context, c Checker) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- c.Check(ctx)
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,181 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunAllPass(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(NewChecker("a", time.Second, true, func(ctx context.Context) error { return nil }), Readiness)
+	r.Register(NewChecker("b", time.Second, false, func(ctx context.Context) error { return nil }), Readiness)
+
+	report := r.Run(context.Background(), Readiness)
+
+	if report.Status != StatusPass {
+		t.Errorf("Expected status %q, got %q", StatusPass, report.Status)
+	}
+	if len(report.Checks) != 2 {
+		t.Fatalf("Expected 2 check results, got %d", len(report.Checks))
+	}
+	if report.Checks[0].Name != "a" || report.Checks[1].Name != "b" {
+		t.Errorf("Expected results in registration order, got %v", report.Checks)
+	}
+}
+
+func TestRunCriticalAndNonCriticalFailures(t *testing.T) {
+	r := NewRegistry(0)
+	fail := func(ctx context.Context) error { return errors.New("boom") }
+	r.Register(NewChecker("optional", time.Second, false, fail), Liveness, Readiness)
+	r.Register(NewChecker("required", time.Second, true, fail), Readiness)
+
+	if report := r.Run(context.Background(), Liveness); report.Status != StatusWarn || !report.Healthy() {
+		t.Errorf("Expected non-critical failure to warn, got %q", report.Status)
+	}
+
+	report := r.Run(context.Background(), Readiness)
+	if report.Status != StatusFail || report.Healthy() {
+		t.Errorf("Expected critical failure to fail, got %q", report.Status)
+	}
+	if report.Checks[1].Error != "boom" {
+		t.Errorf("Expected error message 'boom', got %q", report.Checks[1].Error)
+	}
+}
+
+func TestRunConcurrentlyWithTimeout(t *testing.T) {
+	r := NewRegistry(0)
+	block := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	r.Register(NewChecker("slow-1", 50*time.Millisecond, true, block), Readiness)
+	r.Register(NewChecker("slow-2", 50*time.Millisecond, true, block), Readiness)
+
+	start := time.Now()
+	report := r.Run(context.Background(), Readiness)
+	elapsed := time.Since(start)
+
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("Expected checks to run concurrently and time out, took %v", elapsed)
+	}
+	if report.Status != StatusFail {
+		t.Errorf("Expected timed out checks to fail, got %q", report.Status)
+	}
+}
+
+func TestRunCachesResults(t *testing.T) {
+	r := NewRegistry(time.Minute)
+	var calls atomic.Int32
+	r.Register(NewChecker("counted", time.Second, true, func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}), Liveness, Readiness)
+
+	r.Run(context.Background(), Liveness)
+	r.Run(context.Background(), Readiness)
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected cached result to be reused, check ran %d times", n)
+	}
+}
+
+func TestRunCachedChecksOutliveCaller(t *testing.T) {
+	r := NewRegistry(time.Minute)
+	var calls atomic.Int32
+	check := func(ctx context.Context) error {
+		calls.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return nil
+		}
+	}
+	r.Register(NewChecker("bounded", time.Second, true, check), Readiness)
+	r.Register(NewChecker("unbounded", 0, true, check), Liveness)
+
+	// The client of the first probe has already gone away
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(canceled, Readiness)
+	r.Run(canceled, Liveness)
+
+	if report := r.Run(context.Background(), Readiness); report.Status != StatusPass {
+		t.Errorf("Expected the check to pass regardless of the first caller, got %+v", report.Checks)
+	}
+	if report := r.Run(context.Background(), Liveness); report.Status != StatusPass {
+		t.Errorf("Expected the caller's cancellation not to be cached, got %+v", report.Checks)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected the bounded check to run once and the unbounded one twice, got %d runs", n)
+	}
+}
+
+func TestRunSharesInflightChecks(t *testing.T) {
+	r := NewRegistry(time.Minute)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	r.Register(NewChecker("slow", time.Second, true, func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		return nil
+	}), Readiness)
+
+	var wg sync.WaitGroup
+	reports := make([]Report, 10)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = r.Run(context.Background(), Readiness)
+		}(i)
+	}
+	// Let every probe miss the cache before the check completes
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected concurrent probes to share one run, got %d runs", n)
+	}
+	for i, report := range reports {
+		if report.Status != StatusPass {
+			t.Errorf("Expected probe %d to pass, got %+v", i, report.Checks)
+		}
+	}
+}
+
+func TestRunRecoversPanics(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register(NewChecker("panics", time.Second, true, func(ctx context.Context) error {
+		panic("unexpected")
+	}), Liveness)
+
+	if report := r.Run(context.Background(), Liveness); report.Status != StatusFail {
+		t.Errorf("Expected panicking check to fail, got %q", report.Status)
+	}
+}
+
+func TestStartupLatches(t *testing.T) {
+	r := NewRegistry(0)
+	started := NewToggle("startup", false, "not started")
+	r.Register(started, Startup)
+
+	if report := r.Run(context.Background(), Startup); report.Healthy() {
+		t.Error("Expected startup probe to fail before the toggle is set")
+	}
+
+	started.Set(true)
+	if report := r.Run(context.Background(), Startup); !report.Healthy() {
+		t.Error("Expected startup probe to pass once the toggle is set")
+	}
+
+	started.Set(false)
+	if report := r.Run(context.Background(), Startup); !report.Healthy() {
+		t.Error("Expected startup probe to keep passing after the first success")
+	}
+}
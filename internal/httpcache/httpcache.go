@@ -0,0 +1,77 @@
+// Package httpcache generates HTTP validators (ETag, Last-Modified) and
+// answers conditional GET requests with 304 Not Modified.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns a strong entity tag for content, derived from its SHA-256
+// hash. Strong tags must only be used for byte-identical representations.
+func ETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak entity tag for content, for representations that
+// are equivalent but not byte-identical, such as ones carrying a timestamp
+func WeakETag(content []byte) string {
+	return "W/" + ETag(content)
+}
+
+// NotModified sets the ETag and Last-Modified headers (when non-empty) and,
+// if the GET or HEAD request's If-None-Match or If-Modified-Since header
+// shows the client's copy is current, replies 304 Not Modified and returns
+// true. If-None-Match takes precedence over If-Modified-Since (RFC 9110,
+// section 13.2.2) and is compared weakly.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, modTime time.Time) bool {
+	h := w.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !matchETag(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modTime.IsZero() {
+		since, err := http.ParseTime(ims)
+		// Last-Modified has a one second resolution
+		if err != nil || modTime.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matchETag reports whether the If-None-Match header lists etag or "*",
+// ignoring weakness indicators
+func matchETag(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	etag := ETag([]byte("hello"))
+
+	if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) != 34 {
+		t.Errorf("Expected a quoted 32 character tag, got %s", etag)
+	}
+	if etag != ETag([]byte("hello")) {
+		t.Error("Expected the same tag for the same content")
+	}
+	if etag == ETag([]byte("world")) {
+		t.Error("Expected different tags for different content")
+	}
+	if weak := WeakETag([]byte("hello")); weak != "W/"+etag {
+		t.Errorf("Expected the weak tag W/%s, got %s", etag, weak)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := ETag([]byte("hello"))
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+	lastModified := modTime.Format(http.TimeFormat)
+	earlier := modTime.Add(-time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		ifModSince  string
+		want        bool
+	}{
+		{"no conditions", "GET", "", "", false},
+		{"matching etag", "GET", etag, "", true},
+		{"weak match", "GET", "W/" + etag, "", true},
+		{"listed etag", "GET", `"other", ` + etag, "", true},
+		{"any etag", "HEAD", "*", "", true},
+		{"other etag", "GET", `"other"`, "", false},
+		{"not modified since", "GET", "", lastModified, true},
+		{"modified since", "GET", "", earlier, false},
+		{"invalid date", "GET", "", "yesterday", false},
+		{"etag takes precedence", "GET", `"other"`, lastModified, false},
+		{"unsafe method", "POST", etag, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			if tt.ifModSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModSince)
+			}
+			rr := httptest.NewRecorder()
+			rr.Header().Set("Content-Type", "application/json")
+
+			got := NotModified(rr, req, etag, modTime)
+
+			if got != tt.want {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			if rr.Header().Get("ETag") != etag || rr.Header().Get("Last-Modified") != lastModified {
+				t.Errorf("Expected the validators to be set, got %v", rr.Header())
+			}
+			if got && (rr.Code != http.StatusNotModified || rr.Header().Get("Content-Type") != "") {
+				t.Errorf("Expected a bare 304 response, got %d %v", rr.Code, rr.Header())
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package identity carries the authenticated caller of a request through its
+// context, independently of how the caller was authenticated.
+package identity
+
+import (
+	"context"
+	"crypto/x509"
+	"slices"
+)
+
+// Authentication methods
+const (
+	MethodClientCert = "mtls"
+	MethodJWT        = "jwt"
+	MethodAPIKey     = "api_key"
+)
+
+// Identity describes an authenticated caller
+type Identity struct {
+	// Method is how the caller was authenticated, e.g. MethodClientCert
+	Method string
+	// Subject uniquely identifies the caller
+	Subject string
+	// Scopes lists the permissions granted to the caller
+	Scopes []string
+	// Certificate is the verified client certificate for MethodClientCert
+	Certificate *x509.Certificate
+	// KeyID is the ID of the API key for MethodAPIKey
+	KeyID string
+}
+
+// HasScope reports whether the identity was granted scope
+func (id *Identity) HasScope(scope string) bool {
+	return slices.Contains(id.Scopes, scope)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// FromCertificate builds the identity of a verified client certificate.
+// The subject is the certificate's common name, falling back to its first
+// URI (e.g. a SPIFFE ID) or DNS subject alternative name.
+func FromCertificate(cert *x509.Certificate) *Identity {
+	subject := cert.Subject.CommonName
+	switch {
+	case subject != "":
+	case len(cert.URIs) > 0:
+		subject = cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		subject = cert.DNSNames[0]
+	}
+	return &Identity{
+		Method:      MethodClientCert,
+		Subject:     subject,
+		Certificate: cert,
+	}
+}
@@ -0,0 +1,50 @@
+package identity
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("Expected no identity in an empty context")
+	}
+
+	id := &Identity{Method: "test", Subject: "alice", Scopes: []string{"read"}}
+	got, ok := FromContext(NewContext(context.Background(), id))
+	if !ok || got.Subject != "alice" {
+		t.Errorf("Expected identity alice, got %v", got)
+	}
+	if !got.HasScope("read") || got.HasScope("write") {
+		t.Errorf("Unexpected scopes: %v", got.Scopes)
+	}
+}
+
+func TestFromCertificate(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/default/sa/client")
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "client-a"}, URIs: []*url.URL{spiffe}}, "client-a"},
+		{"uri", &x509.Certificate{URIs: []*url.URL{spiffe}}, spiffe.String()},
+		{"dns", &x509.Certificate{DNSNames: []string{"client.example.com"}}, "client.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := FromCertificate(tt.cert)
+			if id.Subject != tt.want {
+				t.Errorf("Expected subject %q, got %q", tt.want, id.Subject)
+			}
+			if id.Method != MethodClientCert || id.Certificate != tt.cert {
+				t.Errorf("Unexpected identity: %+v", id)
+			}
+		})
+	}
+}
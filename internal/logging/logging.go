@@ -0,0 +1,136 @@
+// Package logging builds the application's structured logger on log/slog.
+//
+// Loggers created by New attach request-scoped attributes to every record
+// logged with a context: the request ID stored with WithRequestID and the
+// trace and span IDs of the active OpenTelemetry span. Use FromContext in
+// request handlers to obtain the logger stored by the request middleware.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys added to request-scoped records
+const (
+	RequestIDKey = "request_id"
+	TraceIDKey   = "trace_id"
+	SpanIDKey    = "span_id"
+)
+
+// level is shared by every logger created with New so that it can be
+// changed at runtime (see SetLevel)
+var level slog.LevelVar
+
+// New creates a logger writing to w with the level and format from cfg.
+// Unknown formats fall back to JSON and unknown levels to info.
+// Loggers created by New share a single level: creating one resets it to
+// cfg.Level for all of them.
+func New(cfg config.LoggingConfig, w io.Writer) *slog.Logger {
+	level.Set(ParseLevel(cfg.Level))
+	opts := &slog.HandlerOptions{Level: &level}
+
+	var h slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(NewContextHandler(h))
+}
+
+// Level returns the current level of the loggers created by New
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the level of every logger created by New
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// ParseLevel converts a configured level name to a slog.Level
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// ContextHandler is a slog.Handler that adds the request ID and the
+// OpenTelemetry trace and span IDs found in the record's context
+type ContextHandler struct {
+	slog.Handler
+}
+
+// NewContextHandler wraps h so that records carry request-scoped attributes
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+// Handle adds the context attributes to r and passes it to the wrapped handler
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String(TraceIDKey, sc.TraceID().String()),
+			slog.String(SpanIDKey, sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a ContextHandler whose wrapped handler has the given attributes
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a ContextHandler whose wrapped handler uses the given group
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger stored in ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
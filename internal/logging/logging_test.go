@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+
+	logger.Info("hello", "key", "value")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse JSON log line %q: %v", buf.String(), err)
+	}
+	if entry["msg"] != "hello" || entry["key"] != "value" {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+}
+
+func TestNewText(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LoggingConfig{Level: "info", Format: "text"}, &buf)
+
+	logger.Info("hello", "key", "value")
+
+	if line := buf.String(); !strings.Contains(line, "msg=hello") || !strings.Contains(line, "key=value") {
+		t.Errorf("Expected text log line, got %q", line)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LoggingConfig{Level: "warn", Format: "json"}, &buf)
+
+	logger.Info("dropped")
+	logger.Warn("kept")
+
+	if out := buf.String(); strings.Contains(out, "dropped") || !strings.Contains(out, "kept") {
+		t.Errorf("Expected only warn records, got %q", out)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+
+	logger.Debug("before")
+	SetLevel(slog.LevelDebug)
+	defer SetLevel(slog.LevelInfo)
+	logger.Debug("after")
+
+	if Level() != slog.LevelDebug {
+		t.Errorf("Expected level debug, got %v", Level())
+	}
+	if out := buf.String(); strings.Contains(out, "before") || !strings.Contains(out, "after") {
+		t.Errorf("Expected the level change to apply to the existing logger, got %q", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"error":   slog.LevelError,
+		"unknown": slog.LevelInfo,
+	}
+	for in, want := range tests {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = WithRequestID(ctx, "req-123")
+
+	logger.With("component", "test").InfoContext(ctx, "with context")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse JSON log line %q: %v", buf.String(), err)
+	}
+
+	want := map[string]string{
+		RequestIDKey: "req-123",
+		TraceIDKey:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanIDKey:    "00f067aa0ba902b7",
+		"component":  "test",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("Expected %s=%q, got %v", key, value, entry[key])
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("Expected the default logger when none is stored")
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	if FromContext(NewContext(context.Background(), logger)) != logger {
+		t.Error("Expected the logger stored in the context")
+	}
+}
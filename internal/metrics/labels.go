@@ -0,0 +1,60 @@
+package metrics
+
+import "net/http"
+
+// Label values standing in for unbounded ones
+const (
+	// OtherMethod replaces request methods outside the standard set
+	OtherMethod = "_OTHER"
+	// UnmatchedEndpoint is the endpoint of requests matching no route
+	UnmatchedEndpoint = "unmatched"
+	// OverflowEndpoint is the endpoint of routes seen after the cap on
+	// distinct endpoints was reached
+	OverflowEndpoint = "overflow"
+)
+
+// KnownMethod reports whether method is one of the standard HTTP methods
+func KnownMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// Method returns the method label of a request: the method itself for the
+// standard ones, OtherMethod otherwise
+func (m *Metrics) Method(method string) string {
+	if KnownMethod(method) {
+		return method
+	}
+	return OtherMethod
+}
+
+// Endpoint returns the endpoint label of a request given the template of the
+// route it matched: UnmatchedEndpoint if there is none, and OverflowEndpoint
+// for templates first seen once max_endpoints distinct ones are in use
+func (m *Metrics) Endpoint(route string, matched bool) string {
+	if !matched {
+		return UnmatchedEndpoint
+	}
+
+	m.mu.RLock()
+	_, ok := m.endpoints[route]
+	m.mu.RUnlock()
+	if ok {
+		return route
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.endpoints[route]; ok {
+		return route
+	}
+	if len(m.endpoints) >= m.maxEndpoints {
+		return OverflowEndpoint
+	}
+	m.endpoints[route] = struct{}{}
+	return route
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMethod(t *testing.T) {
+	m := New(config.Default().Prometheus, prometheus.NewRegistry())
+
+	tests := map[string]string{
+		"GET":     "GET",
+		"OPTIONS": "OPTIONS",
+		"PURGE":   OtherMethod,
+		"get":     OtherMethod,
+		"":        OtherMethod,
+	}
+	for method, want := range tests {
+		if got := m.Method(method); got != want {
+			t.Errorf("Method(%q) = %q; expected %q", method, got, want)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	cfg := config.Default().Prometheus
+	cfg.MaxEndpoints = 2
+	m := New(cfg, prometheus.NewRegistry())
+
+	if got := m.Endpoint("", false); got != UnmatchedEndpoint {
+		t.Errorf("Expected %q for unmatched requests, got %q", UnmatchedEndpoint, got)
+	}
+
+	for _, route := range []string{"/ping", "/items/{id}", "/ping"} {
+		if got := m.Endpoint(route, true); got != route {
+			t.Errorf("Expected %q within the cap, got %q", route, got)
+		}
+	}
+	if got := m.Endpoint("/echo", true); got != OverflowEndpoint {
+		t.Errorf("Expected %q beyond the cap, got %q", OverflowEndpoint, got)
+	}
+	if got := m.Endpoint("/items/{id}", true); got != "/items/{id}" {
+		t.Errorf("Expected known endpoints to be kept, got %q", got)
+	}
+}
+
+func TestEndpointConcurrent(t *testing.T) {
+	cfg := config.Default().Prometheus
+	cfg.MaxEndpoints = 10
+	m := New(cfg, prometheus.NewRegistry())
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Endpoint(fmt.Sprintf("/route/%d", i), true)
+		}()
+	}
+	wg.Wait()
+
+	if len(m.endpoints) != 10 {
+		t.Errorf("Expected the cap of 10 endpoints, got %d", len(m.endpoints))
+	}
+}
@@ -0,0 +1,230 @@
+// Package metrics holds the Prometheus collectors of the service and serves
+// them from their own registry.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics holds the collectors recorded by the middleware and handlers
+type Metrics struct {
+	registry  *prometheus.Registry
+	handler   http.Handler
+	exemplars bool
+
+	mu           sync.RWMutex
+	endpoints    map[string]struct{}
+	maxEndpoints int
+
+	// RequestsTotal counts HTTP requests by method, endpoint and status
+	RequestsTotal *prometheus.CounterVec
+	// RequestDuration measures HTTP request duration in seconds by method
+	// and endpoint
+	RequestDuration *prometheus.HistogramVec
+	// RequestSize observes request body sizes in bytes by method and endpoint
+	RequestSize *prometheus.HistogramVec
+	// ResponseSize observes response body sizes in bytes, before
+	// compression, by method and endpoint
+	ResponseSize *prometheus.HistogramVec
+	// RequestsInFlight is the number of requests being served
+	RequestsInFlight prometheus.Gauge
+
+	// PanicsTotal counts panics recovered from HTTP handlers by method and
+	// endpoint
+	PanicsTotal *prometheus.CounterVec
+	// RateLimitedTotal counts requests rejected by the rate limiter by
+	// method, endpoint and the kind of client key (ip, api_key or subject)
+	RateLimitedTotal *prometheus.CounterVec
+	// RequestTimeoutsTotal counts requests that exceeded their deadline by
+	// method, endpoint and the source of the deadline (route or client)
+	RequestTimeoutsTotal *prometheus.CounterVec
+	// ClientRequestsTotal counts requests authenticated with an API key by
+	// method, endpoint, status and the key's client name
+	ClientRequestsTotal *prometheus.CounterVec
+
+	// CompressionInputBytesTotal counts response body bytes before
+	// compression, by content encoding
+	CompressionInputBytesTotal *prometheus.CounterVec
+	// CompressionOutputBytesTotal counts compressed response body bytes
+	// sent, by content encoding
+	CompressionOutputBytesTotal *prometheus.CounterVec
+	// CompressionRatio observes the compressed to uncompressed size ratio
+	// of responses by content encoding; lower is better
+	CompressionRatio *prometheus.HistogramVec
+
+	// CSPViolationsTotal counts Content-Security-Policy violation reports
+	// by directive and disposition (enforce or report)
+	CSPViolationsTotal *prometheus.CounterVec
+
+	// LabelValuesDroppedTotal counts requests whose method or endpoint was
+	// replaced by OtherMethod, UnmatchedEndpoint or OverflowEndpoint, by label
+	LabelValuesDroppedTotal *prometheus.CounterVec
+}
+
+// New creates the collectors described by the configuration and registers
+// them, and the Go runtime and process collectors if enabled, with reg
+func New(cfg config.PrometheusConfig, reg *prometheus.Registry) *Metrics {
+	histogram := func(opts prometheus.HistogramOpts, labels ...string) *prometheus.HistogramVec {
+		if cfg.NativeHistograms {
+			opts.NativeHistogramBucketFactor = 1.1
+			opts.NativeHistogramMaxBucketNumber = 160
+			opts.NativeHistogramMinResetDuration = time.Hour
+		}
+		return prometheus.NewHistogramVec(opts, labels)
+	}
+
+	m := &Metrics{
+		registry:     reg,
+		exemplars:    cfg.Exemplars,
+		endpoints:    make(map[string]struct{}),
+		maxEndpoints: cfg.MaxEndpoints,
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		}, []string{"method", "endpoint", "status"}),
+		RequestDuration: histogram(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request duration in seconds",
+			Buckets: cfg.DurationBuckets,
+		}, "method", "endpoint"),
+		RequestSize: histogram(prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "HTTP request body size in bytes",
+			Buckets: cfg.SizeBuckets,
+		}, "method", "endpoint"),
+		ResponseSize: histogram(prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "HTTP response body size in bytes, before compression",
+			Buckets: cfg.SizeBuckets,
+		}, "method", "endpoint"),
+		RequestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being served",
+		}),
+		PanicsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_panics_total",
+			Help: "Total number of panics recovered from HTTP handlers",
+		}, []string{"method", "endpoint"}),
+		RateLimitedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_rate_limited_requests_total",
+			Help: "Total number of HTTP requests rejected by rate limiting",
+		}, []string{"method", "endpoint", "key"}),
+		RequestTimeoutsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_request_timeouts_total",
+			Help: "Total number of HTTP requests that timed out",
+		}, []string{"method", "endpoint", "source"}),
+		ClientRequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_client_requests_total",
+			Help: "Total number of HTTP requests authenticated with an API key, by client",
+		}, []string{"method", "endpoint", "status", "client"}),
+		CompressionInputBytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_response_compression_input_bytes_total",
+			Help: "Total number of response body bytes passed to compression",
+		}, []string{"encoding"}),
+		CompressionOutputBytesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_response_compression_output_bytes_total",
+			Help: "Total number of compressed response body bytes sent",
+		}, []string{"encoding"}),
+		CompressionRatio: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_response_compression_ratio",
+			Help:    "Ratio of compressed to uncompressed response body size",
+			Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+		}, []string{"encoding"}),
+		CSPViolationsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "csp_violations_total",
+			Help: "Total number of Content-Security-Policy violation reports",
+		}, []string{"directive", "disposition"}),
+		LabelValuesDroppedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_metric_label_values_dropped_total",
+			Help: "Total number of label values replaced to bound the number of series",
+		}, []string{"label"}),
+	}
+
+	reg.MustRegister(
+		m.RequestsTotal,
+		m.RequestDuration,
+		m.RequestSize,
+		m.ResponseSize,
+		m.RequestsInFlight,
+		m.PanicsTotal,
+		m.RateLimitedTotal,
+		m.RequestTimeoutsTotal,
+		m.ClientRequestsTotal,
+		m.CompressionInputBytesTotal,
+		m.CompressionOutputBytesTotal,
+		m.CompressionRatio,
+		m.CSPViolationsTotal,
+		m.LabelValuesDroppedTotal,
+	)
+	if cfg.RuntimeCollectors {
+		reg.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	// The handler counts its own scrapes and errors in the registry, like
+	// promhttp.Handler does for the default one
+	m.handler = promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		Registry:          reg,
+	}))
+	return m
+}
+
+// Registry returns the registry the collectors are registered with, for
+// other collectors such as the OpenTelemetry Prometheus exporter
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns the handler serving the registry in the format the
+// scraper negotiates: Prometheus text, OpenMetrics (with exemplars) or
+// protobuf (with native histograms)
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
+}
+
+// Observe records v in o with the trace ID of ctx as exemplar when the
+// request is sampled and exemplars are enabled
+func (m *Metrics) Observe(ctx context.Context, o prometheus.Observer, v float64) {
+	if labels := m.exemplar(ctx); labels != nil {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, labels)
+			return
+		}
+	}
+	o.Observe(v)
+}
+
+// Inc increments c with the trace ID of ctx as exemplar when the request is
+// sampled and exemplars are enabled
+func (m *Metrics) Inc(ctx context.Context, c prometheus.Counter) {
+	if labels := m.exemplar(ctx); labels != nil {
+		if ea, ok := c.(prometheus.ExemplarAdder); ok {
+			ea.AddWithExemplar(1, labels)
+			return
+		}
+	}
+	c.Inc()
+}
+
+func (m *Metrics) exemplar(ctx context.Context) prometheus.Labels {
+	if !m.exemplars {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": sc.TraceID().String()}
+}
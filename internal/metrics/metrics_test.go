@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sampledContext returns a context carrying a sampled span context
+func sampledContext(flags trace.TraceFlags) context.Context {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+	}))
+}
+
+// gather returns the metric families of reg by name
+func gather(t *testing.T, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() returned an error: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+	return byName
+}
+
+func TestNewRuntimeCollectors(t *testing.T) {
+	cfg := config.Default().Prometheus
+
+	reg := prometheus.NewRegistry()
+	New(cfg, reg)
+	families := gather(t, reg)
+	if families["go_goroutines"] == nil {
+		t.Error("Expected the Go runtime collector to be registered")
+	}
+
+	cfg.RuntimeCollectors = false
+	reg = prometheus.NewRegistry()
+	New(cfg, reg)
+	if gather(t, reg)["go_goroutines"] != nil {
+		t.Error("Expected no Go runtime metrics with runtime_collectors disabled")
+	}
+}
+
+func TestHistograms(t *testing.T) {
+	cfg := config.Default().Prometheus
+	cfg.DurationBuckets = []float64{0.1, 1}
+	reg := prometheus.NewRegistry()
+	m := New(cfg, reg)
+
+	m.RequestDuration.WithLabelValues("GET", "/ping").Observe(0.5)
+
+	h := gather(t, reg)["http_request_duration_seconds"].GetMetric()[0].GetHistogram()
+	if len(h.GetBucket()) != 2 || h.GetBucket()[1].GetUpperBound() != 1 {
+		t.Errorf("Expected the configured buckets, got %v", h.GetBucket())
+	}
+	if h.Schema == nil {
+		t.Error("Expected a native histogram schema")
+	}
+
+	cfg.NativeHistograms = false
+	reg = prometheus.NewRegistry()
+	m = New(cfg, reg)
+	m.RequestDuration.WithLabelValues("GET", "/ping").Observe(0.5)
+	if h := gather(t, reg)["http_request_duration_seconds"].GetMetric()[0].GetHistogram(); h.Schema != nil {
+		t.Error("Expected a classic histogram only")
+	}
+}
+
+func TestExemplars(t *testing.T) {
+	tests := []struct {
+		name      string
+		exemplars bool
+		flags     trace.TraceFlags
+		want      bool
+	}{
+		{"sampled", true, trace.FlagsSampled, true},
+		{"not sampled", true, 0, false},
+		{"disabled", false, trace.FlagsSampled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default().Prometheus
+			cfg.Exemplars = tt.exemplars
+			reg := prometheus.NewRegistry()
+			m := New(cfg, reg)
+
+			ctx := sampledContext(tt.flags)
+			m.Inc(ctx, m.RequestsTotal.WithLabelValues("GET", "/ping", "200"))
+			m.Observe(ctx, m.RequestDuration.WithLabelValues("GET", "/ping"), 0.02)
+
+			families := gather(t, reg)
+			counter := families["http_requests_total"].GetMetric()[0].GetCounter()
+			if got := counter.GetExemplar() != nil; got != tt.want {
+				t.Errorf("Expected counter exemplar %v, got %v", tt.want, counter.GetExemplar())
+			}
+			var exemplar *dto.Exemplar
+			for _, b := range families["http_request_duration_seconds"].GetMetric()[0].GetHistogram().GetBucket() {
+				if b.GetExemplar() != nil {
+					exemplar = b.GetExemplar()
+				}
+			}
+			if got := exemplar != nil; got != tt.want {
+				t.Fatalf("Expected histogram exemplar %v, got %v", tt.want, exemplar)
+			}
+			if exemplar != nil && exemplar.GetLabel()[0].GetValue() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("Expected the trace ID as exemplar, got %v", exemplar.GetLabel())
+			}
+		})
+	}
+}
+
+func TestHandlerFormats(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(config.Default().Prometheus, reg)
+	m.Inc(sampledContext(trace.FlagsSampled), m.RequestsTotal.WithLabelValues("GET", "/ping", "200"))
+
+	tests := []struct {
+		accept      string
+		contentType string
+		exemplar    bool
+	}{
+		{"", "text/plain", false},
+		{"application/openmetrics-text; version=1.0.0", "application/openmetrics-text", true},
+		{"application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited", "application/vnd.google.protobuf", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+		m.Handler().ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+			t.Errorf("Accept %q: expected Content-Type %s, got %q", tt.accept, tt.contentType, got)
+		}
+		if got := strings.Contains(rr.Body.String(), `# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"}`); got != tt.exemplar {
+			t.Errorf("Accept %q: expected exemplar in body %v, got %v", tt.accept, tt.exemplar, got)
+		}
+	}
+
+	// The handler counts its own scrapes in the registry
+	if gather(t, reg)["promhttp_metric_handler_requests_total"] == nil {
+		t.Error("Expected the scrapes to be counted")
+	}
+}
@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Access log formats
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+	AccessLogLogfmt   = "logfmt"
+)
+
+// accessLogEntry holds everything recorded about a completed request
+type accessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	URI        string
+	Proto      string
+	Route      string
+	Status     int
+	Bytes      int64
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+	RequestID  string
+	TraceID    string
+}
+
+// AccessLogger writes one line per completed request
+type AccessLogger struct {
+	format   string
+	out      io.Writer
+	trusted  []*net.IPNet
+	exclude  map[string]bool
+	prefixes []string
+	redact   []string
+
+	mu sync.Mutex
+}
+
+// NewAccessLogger creates an AccessLogger writing to out in the configured
+// format. trustedProxies lists the proxies whose X-Forwarded-For header is
+// used to determine the client address.
+func NewAccessLogger(cfg config.AccessLogConfig, trustedProxies []string, out io.Writer) (*AccessLogger, error) {
+	switch cfg.Format {
+	case AccessLogCombined, AccessLogJSON, AccessLogLogfmt:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", cfg.Format)
+	}
+
+	trusted, err := ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &AccessLogger{
+		format:  cfg.Format,
+		out:     out,
+		trusted: trusted,
+		exclude: make(map[string]bool),
+		redact:  cfg.RedactQuery,
+	}
+	for _, p := range cfg.ExcludePaths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			l.prefixes = append(l.prefixes, prefix)
+		} else {
+			l.exclude[p] = true
+		}
+	}
+	return l, nil
+}
+
+// Middleware logs each request after the handler has completed, recording
+// the response status, body size and latency. Requests whose handler
+// panicked are logged with status 500, as RecoveryMiddleware answers them.
+// Excluded paths are not logged.
+func (l *AccessLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rw := newResponseWriter(w)
+
+		defer func() {
+			p := recover()
+			status := rw.statusCode
+			if p != nil && !rw.wroteHeader {
+				status = http.StatusInternalServerError
+			}
+			l.log(r, rw, start, status)
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// log writes the access log entry of a completed request
+func (l *AccessLogger) log(r *http.Request, rw *responseWriter, start time.Time, status int) {
+	entry := accessLogEntry{
+		Time:       start,
+		RemoteAddr: ClientIP(r, l.trusted),
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Status:     status,
+		Bytes:      rw.bytes,
+		Duration:   time.Since(start),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		RequestID:  logging.RequestID(r.Context()),
+	}
+	if entry.URI == "" {
+		entry.URI = r.URL.RequestURI()
+	}
+	entry.URI = l.redactURI(entry.URI)
+	if template, ok := routeTemplate(r); ok {
+		entry.Route = template
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		entry.TraceID = sc.TraceID().String()
+	}
+
+	l.write(entry)
+}
+
+// redactQueryValue replaces the values of redacted query parameters
+const redactQueryValue = "REDACTED"
+
+// redactURI masks the values of the redacted query parameters in uri,
+// leaving the rest of it untouched
+func (l *AccessLogger) redactURI(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok || len(l.redact) == 0 {
+		return uri
+	}
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && slices.Contains(l.redact, unescaped) {
+			params[i] = name + "=" + redactQueryValue
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+func (l *AccessLogger) excluded(path string) bool {
+	if l.exclude[path] {
+		return true
+	}
+	for _, prefix := range l.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *AccessLogger) write(e accessLogEntry) {
+	var line []byte
+	switch l.format {
+	case AccessLogJSON:
+		line = formatJSON(e)
+	case AccessLogLogfmt:
+		line = formatLogfmt(e)
+	default:
+		line = formatCombined(e)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// formatCombined renders the NCSA Combined Log Format
+func formatCombined(e accessLogEntry) []byte {
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Appendf(nil, "%s - - [%s] %q %d %s %q %q\n",
+		e.RemoteAddr,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.URI+" "+e.Proto,
+		e.Status,
+		size,
+		orDash(e.Referer),
+		orDash(e.UserAgent),
+	)
+}
+
+func formatJSON(e accessLogEntry) []byte {
+	line, _ := json.Marshal(struct {
+		Time       string  `json:"time"`
+		RemoteAddr string  `json:"remote_addr"`
+		Method     string  `json:"method"`
+		URI        string  `json:"uri"`
+		Proto      string  `json:"proto"`
+		Route      string  `json:"route,omitempty"`
+		Status     int     `json:"status"`
+		Bytes      int64   `json:"bytes"`
+		DurationMS float64 `json:"duration_ms"`
+		Referer    string  `json:"referer,omitempty"`
+		UserAgent  string  `json:"user_agent,omitempty"`
+		RequestID  string  `json:"request_id,omitempty"`
+		TraceID    string  `json:"trace_id,omitempty"`
+	}{
+		Time:       e.Time.UTC().Format(time.RFC3339Nano),
+		RemoteAddr: e.RemoteAddr,
+		Method:     e.Method,
+		URI:        e.URI,
+		Proto:      e.Proto,
+		Route:      e.Route,
+		Status:     e.Status,
+		Bytes:      e.Bytes,
+		DurationMS: durationMS(e.Duration),
+		Referer:    e.Referer,
+		UserAgent:  e.UserAgent,
+		RequestID:  e.RequestID,
+		TraceID:    e.TraceID,
+	})
+	return append(line, '\n')
+}
+
+func formatLogfmt(e accessLogEntry) []byte {
+	var b strings.Builder
+	field := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if strings.ContainsAny(value, " \"=\\") || !strconv.CanBackquote(value) {
+			b.WriteString(strconv.Quote(value))
+		} else {
+			b.WriteString(value)
+		}
+	}
+
+	field("time", e.Time.UTC().Format(time.RFC3339Nano))
+	field("remote_addr", e.RemoteAddr)
+	field("method", e.Method)
+	field("uri", e.URI)
+	field("proto", e.Proto)
+	field("route", e.Route)
+	field("status", strconv.Itoa(e.Status))
+	field("bytes", strconv.FormatInt(e.Bytes, 10))
+	field("duration_ms", strconv.FormatFloat(durationMS(e.Duration), 'f', 3, 64))
+	field("referer", e.Referer)
+	field("user_agent", e.UserAgent)
+	field("request_id", e.RequestID)
+	field("trace_id", e.TraceID)
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/gorilla/mux"
+)
+
+// serveAccessLog routes a request through a mux with the access logger
+// applied and returns the logged output
+func serveAccessLog(t *testing.T, cfg config.AccessLogConfig, trusted []string, req *http.Request) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger, err := NewAccessLogger(cfg, trusted, &buf)
+	if err != nil {
+		t.Fatalf("NewAccessLogger() returned an error: %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(logger.Middleware)
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	r.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/items/42?x=1", nil)
+	req.RemoteAddr = "192.0.2.10:1234"
+	req.Header.Set("User-Agent", "test-agent")
+
+	out := serveAccessLog(t, config.AccessLogConfig{Format: AccessLogJSON}, nil, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("Failed to parse access log %q: %v", out, err)
+	}
+
+	want := map[string]interface{}{
+		"method":      "POST",
+		"uri":         "/items/42?x=1",
+		"route":       "/items/{id}",
+		"status":      float64(http.StatusCreated),
+		"bytes":       float64(5),
+		"remote_addr": "192.0.2.10",
+		"user_agent":  "test-agent",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["duration_ms"].(float64); !ok {
+		t.Errorf("Expected duration_ms, got %v", entry["duration_ms"])
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	req.RemoteAddr = "192.0.2.10:1234"
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Referer", "http://example.com/")
+
+	out := serveAccessLog(t, config.AccessLogConfig{Format: AccessLogCombined}, nil, req)
+
+	pattern := `^192\.0\.2\.10 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /items/1 HTTP/1\.1" 201 5 "http://example.com/" "test-agent"\n$`
+	if !regexp.MustCompile(pattern).MatchString(out) {
+		t.Errorf("Access log does not match Combined Log Format: %q", out)
+	}
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	req.Header.Set("User-Agent", "agent with spaces")
+
+	out := serveAccessLog(t, config.AccessLogConfig{Format: AccessLogLogfmt}, nil, req)
+
+	for _, want := range []string{"method=GET", "route=/items/{id}", "status=201", "bytes=5", `user_agent="agent with spaces"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in logfmt line %q", want, out)
+		}
+	}
+}
+
+func TestAccessLogExcludedPaths(t *testing.T) {
+	cfg := config.AccessLogConfig{Format: AccessLogJSON, ExcludePaths: []string{"/metrics", "/items/*"}}
+
+	for _, path := range []string{"/metrics", "/items/7"} {
+		if out := serveAccessLog(t, cfg, nil, httptest.NewRequest("GET", path, nil)); out != "" {
+			t.Errorf("Expected %s to be excluded, got %q", path, out)
+		}
+	}
+}
+
+func TestAccessLogTrustedProxy(t *testing.T) {
+	req := httptest.NewRequest("GET", "/items/1", nil)
+	req.RemoteAddr = "10.0.0.5:4321"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.4")
+
+	out := serveAccessLog(t, config.AccessLogConfig{Format: AccessLogJSON}, []string{"10.0.0.0/8"}, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("Failed to parse access log %q: %v", out, err)
+	}
+	if entry["remote_addr"] != "203.0.113.7" {
+		t.Errorf("Expected forwarded client address, got %v", entry["remote_addr"])
+	}
+}
+
+func TestAccessLogPanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewAccessLogger(config.AccessLogConfig{Format: AccessLogJSON}, nil, &buf)
+	if err != nil {
+		t.Fatalf("NewAccessLogger() returned an error: %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(RecoveryMiddleware("X-Request-ID", newTestMetrics()), logger.Middleware)
+	r.HandleFunc("/panic/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/panic/1", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", rr.Code)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse access log %q: %v", buf.String(), err)
+	}
+	if entry["status"] != float64(http.StatusInternalServerError) || entry["route"] != "/panic/{id}" {
+		t.Errorf("Expected the panicking request to be logged with status 500, got %v", entry)
+	}
+}
+
+func TestNewAccessLoggerInvalidFormat(t *testing.T) {
+	if _, err := NewAccessLogger(config.AccessLogConfig{Format: "xml"}, nil, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestAccessLogRedactsQuery(t *testing.T) {
+	cfg := config.AccessLogConfig{Format: AccessLogJSON, RedactQuery: []string{"api_key"}}
+	req := httptest.NewRequest("GET", "/items/1?page=2&api_key=lgo_secret&api%5Fkey=other", nil)
+
+	out := serveAccessLog(t, cfg, nil, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("Failed to parse access log %q: %v", out, err)
+	}
+	if want := "/items/1?page=2&api_key=REDACTED&api%5Fkey=REDACTED"; entry["uri"] != want {
+		t.Errorf("Expected uri %q, got %q", want, entry["uri"])
+	}
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/apikey"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/identity"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/internal/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newAPIKeyRouter(t *testing.T, keys *apikey.Store, cfg config.APIKeyConfig, got **identity.Identity, m *metrics.Metrics) *mux.Router {
+	t.Helper()
+	r := mux.NewRouter()
+	r.Use(NewAPIKeyAuthenticator(cfg, keys, ratelimit.NewMemoryStore(), m).Middleware)
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		*got, _ = identity.FromContext(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return r
+}
+
+func newTestKeyStore(t *testing.T) *apikey.Store {
+	t.Helper()
+	keys, err := apikey.NewStore(filepath.Join(t.TempDir(), "api-keys.json"))
+	if err != nil {
+		t.Fatalf("NewStore() returned an error: %v", err)
+	}
+	return keys
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	keys := newTestKeyStore(t)
+	_, plaintext, err := keys.Create("billing", []string{"echo:write"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.APIKeyConfig{Header: "X-API-Key", QueryParam: "api_key"}
+	var id *identity.Identity
+	m := newTestMetrics()
+	r := newAPIKeyRouter(t, keys, cfg, &id, m)
+	counter := m.ClientRequestsTotal.WithLabelValues("GET", "/items/{id}", "202", "billing")
+	before := testutil.ToFloat64(counter)
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+	}{
+		{"header", func() *http.Request {
+			req := httptest.NewRequest("GET", "/items/1", nil)
+			req.Header.Set("X-API-Key", plaintext)
+			return req
+		}},
+		{"query", func() *http.Request {
+			return httptest.NewRequest("GET", "/items/1?api_key="+plaintext, nil)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id = nil
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, tt.req())
+
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d", rr.Code)
+			}
+			if id == nil || id.Method != identity.MethodAPIKey || id.Subject != "billing" || !id.HasScope("echo:write") {
+				t.Errorf("Expected billing API key identity, got %+v", id)
+			}
+		})
+	}
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("Expected 2 requests counted for client billing, got %v", got)
+	}
+}
+
+func TestAPIKeyMiddlewareRejects(t *testing.T) {
+	keys := newTestKeyStore(t)
+	revoked, plaintext, _ := keys.Create("old", nil, nil, nil)
+	keys.Revoke(revoked.ID)
+
+	var id *identity.Identity
+	r := newAPIKeyRouter(t, keys, config.APIKeyConfig{Header: "X-API-Key"}, &id, newTestMetrics())
+
+	for name, key := range map[string]string{"revoked": plaintext, "unknown": apikey.Prefix + "000000000000_x"} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/items/1", nil)
+			req.Header.Set("X-API-Key", key)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("WWW-Authenticate"); got != `ApiKey header="X-API-Key"` {
+				t.Errorf("Unexpected WWW-Authenticate %q", got)
+			}
+		})
+	}
+
+	// Query parameters are ignored unless configured
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/items/1?api_key="+plaintext, nil))
+	if rr.Code != http.StatusAccepted || id != nil {
+		t.Errorf("Expected an anonymous request, got status %d and identity %+v", rr.Code, id)
+	}
+}
+
+func TestAPIKeyMiddlewareQuota(t *testing.T) {
+	keys := newTestKeyStore(t)
+	_, plaintext, _ := keys.Create("batch", nil, nil, &apikey.RateLimit{Requests: 2, Period: time.Minute})
+
+	var id *identity.Identity
+	m := newTestMetrics()
+	r := newAPIKeyRouter(t, keys, config.APIKeyConfig{Header: "X-API-Key"}, &id, m)
+	rejected := m.ClientRequestsTotal.WithLabelValues("GET", "/items/{id}", "429", "batch")
+	before := testutil.ToFloat64(rejected)
+
+	for i, want := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/items/1", nil)
+		req.Header.Set("X-API-Key", plaintext)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != want {
+			t.Fatalf("Request %d: expected status %d, got %d", i, want, rr.Code)
+		}
+		if got := rr.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("Request %d: expected RateLimit-Limit 2, got %q", i, got)
+		}
+	}
+
+	if got := testutil.ToFloat64(rejected) - before; got != 1 {
+		t.Errorf("Expected the rejection to be counted for client batch, got %v", got)
+	}
+}
+
+func TestRateLimitHeadersReportTightestLimit(t *testing.T) {
+	h := http.Header{}
+	minute := ratelimit.Limit{Requests: 10, Period: time.Minute}
+	hour := ratelimit.Limit{Requests: 100, Period: time.Hour}
+
+	writeRateLimitHeaders(h, ratelimit.Result{Allowed: true, Limit: 10, Remaining: 3}, minute)
+	writeRateLimitHeaders(h, ratelimit.Result{Allowed: true, Limit: 100, Remaining: 50}, hour)
+
+	if got := h.Get("RateLimit-Remaining"); got != "3" {
+		t.Errorf("Expected RateLimit-Remaining 3, got %s", got)
+	}
+	if got := h.Values("RateLimit-Policy"); len(got) != 2 {
+		t.Errorf("Expected both policies, got %v", got)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/auth"
+	"github.com/dxas90/learn-go/internal/identity"
+	"github.com/dxas90/learn-go/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AuthMiddleware authenticates requests carrying an "Authorization: Bearer"
+// token. Valid tokens put their claims (see auth.FromContext) and the
+// caller's identity (see identity.FromContext) in the request context;
+// invalid ones are rejected with a 401 problem. Requests without a token
+// pass through anonymously, so routes that need a caller must use
+// RequireScopes.
+func AuthMiddleware(v *auth.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, token, _ := strings.Cut(header, " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+				unauthorized(w, r, `Bearer error="invalid_request"`, "Authorization header must use the Bearer scheme")
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				logging.FromContext(r.Context()).InfoContext(r.Context(), "Rejected bearer token", "error", err)
+				unauthorized(w, r, `Bearer error="invalid_token"`, "The access token is invalid or expired")
+				return
+			}
+
+			id := &identity.Identity{
+				Method:  identity.MethodJWT,
+				Subject: claims.Subject,
+				Scopes:  claims.Scopes(),
+			}
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("enduser.id", id.Subject))
+
+			ctx := auth.NewContext(r.Context(), claims)
+			next.ServeHTTP(w, r.WithContext(identity.NewContext(ctx, id)))
+		})
+	}
+}
+
+// RequireScopes only lets through requests from an authenticated caller
+// granted every one of scopes. Anonymous requests get a 401 problem and
+// callers lacking a scope a 403 problem.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := identity.FromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "Bearer", "Authentication is required")
+				return
+			}
+
+			for _, scope := range scopes {
+				if !id.HasScope(scope) {
+					w.Header().Set("WWW-Authenticate",
+						fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+					apierror.Error(w, r, http.StatusForbidden, "Missing required scope "+scope)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unauthorized sends a 401 problem with the given WWW-Authenticate challenge
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge, detail string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	apierror.Error(w, r, http.StatusUnauthorized, detail)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/auth"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/identity"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestVerifier(t *testing.T) *auth.Verifier {
+	t.Helper()
+	cfg := config.Default().Auth
+	cfg.Enabled = true
+	cfg.Algorithms = []string{"HS256"}
+	cfg.HMACSecret = testHMACSecret
+	v, err := auth.NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an error: %v", err)
+	}
+	return v
+}
+
+func testToken(t *testing.T, scope string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Scope: scope,
+	})
+	signed, err := token.SignedString([]byte(testHMACSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	v := newTestVerifier(t)
+
+	var id *identity.Identity
+	var claims *auth.Claims
+	handler := AuthMiddleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ = identity.FromContext(r.Context())
+		claims, _ = auth.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken(t, "echo:write"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if id == nil || id.Subject != "alice" || id.Method != identity.MethodJWT || !id.HasScope("echo:write") {
+		t.Errorf("Expected alice JWT identity with echo:write, got %+v", id)
+	}
+	if claims == nil || claims.Subject != "alice" {
+		t.Errorf("Expected claims in the context, got %+v", claims)
+	}
+}
+
+func TestAuthMiddlewareAnonymous(t *testing.T) {
+	called := false
+	handler := AuthMiddleware(newTestVerifier(t))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, ok := identity.FromContext(r.Context()); ok {
+			t.Error("Expected no identity for anonymous requests")
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !called {
+		t.Error("Expected anonymous requests to pass through")
+	}
+}
+
+func TestAuthMiddlewareRejects(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		challenge string
+	}{
+		{"basic scheme", "Basic YWxpY2U6c2VjcmV0", `Bearer error="invalid_request"`},
+		{"empty token", "Bearer ", `Bearer error="invalid_request"`},
+		{"bad token", "Bearer not.a.jwt", `Bearer error="invalid_token"`},
+	}
+
+	handler := AuthMiddleware(newTestVerifier(t))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the handler not to be called")
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("Expected WWW-Authenticate %q, got %q", tt.challenge, got)
+			}
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	handler := AuthMiddleware(newTestVerifier(t))(RequireScopes("echo:write")(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})))
+
+	tests := []struct {
+		name      string
+		token     string
+		status    int
+		challenge string
+	}{
+		{"anonymous", "", http.StatusUnauthorized, "Bearer"},
+		{"missing scope", testToken(t, "info:read"), http.StatusForbidden, `Bearer error="insufficient_scope", scope="echo:write"`},
+		{"granted", testToken(t, "info:read echo:write"), http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/echo", strings.NewReader("{}"))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Errorf("Expected WWW-Authenticate %q, got %q", tt.challenge, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/gorilla/mux"
+)
+
+func testBodyConfig() config.RequestBodyConfig {
+	return config.RequestBodyConfig{
+		Enabled:              true,
+		MaxBytes:             100,
+		Routes:               map[string]int64{"/upload": 1000},
+		Decompress:           true,
+		MaxDecompressedBytes: 500,
+	}
+}
+
+// newBodyRouter serves the body read by the handler, or 413 when reading
+// hits the limit
+func newBodyRouter(cfg config.RequestBodyConfig) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(NewBodyLimiter(cfg).Middleware)
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+		w.Write(body)
+	}
+	r.HandleFunc("/echo", echo)
+	r.HandleFunc("/upload", echo)
+	return r
+}
+
+func bodyRequest(r http.Handler, path string, body []byte, encoding string, chunked bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	if chunked {
+		// Hide the length as for a chunked request
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = -1
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func compressed(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var zw io.WriteCloser = gzip.NewWriter(&buf)
+	if encoding == "deflate" {
+		zw = zlib.NewWriter(&buf)
+	}
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := newBodyRouter(testBodyConfig())
+	small, large := bytes.Repeat([]byte("a"), 100), bytes.Repeat([]byte("a"), 101)
+
+	tests := []struct {
+		name    string
+		path    string
+		body    []byte
+		chunked bool
+		status  int
+	}{
+		{"within default limit", "/echo", small, false, http.StatusOK},
+		{"declared length over limit", "/echo", large, false, http.StatusRequestEntityTooLarge},
+		{"streamed body over limit", "/echo", large, true, http.StatusRequestEntityTooLarge},
+		{"route override", "/upload", bytes.Repeat([]byte("a"), 1000), false, http.StatusOK},
+		{"over route limit", "/upload", bytes.Repeat([]byte("a"), 1001), true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := bodyRequest(r, tt.path, tt.body, "", tt.chunked)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+
+	rr := bodyRequest(r, "/echo", large, "", false)
+	if got := rr.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Expected a problem response for a declared length over the limit, got %q", got)
+	}
+	if !strings.Contains(rr.Body.String(), "limit of 100 bytes") {
+		t.Errorf("Expected the limit in the problem detail, got %s", rr.Body.String())
+	}
+}
+
+func TestBodyDecompression(t *testing.T) {
+	r := newBodyRouter(testBodyConfig())
+	data := []byte(`{"message":"hello"}`)
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			rr := bodyRequest(r, "/echo", compressed(t, encoding, data), encoding, false)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+			if rr.Body.String() != string(data) {
+				t.Errorf("Expected the decoded body, got %q", rr.Body.String())
+			}
+			if got := rr.Header().Get("X-Content-Encoding"); got != "" {
+				t.Errorf("Expected Content-Encoding to be removed, got %q", got)
+			}
+		})
+	}
+}
+
+func TestBodyDecompressionLimits(t *testing.T) {
+	r := newBodyRouter(testBodyConfig())
+	// Highly compressible bodies far below the wire limit once compressed
+	bomb := compressed(t, "gzip", bytes.Repeat([]byte("a"), 64<<10))
+	overRoute := compressed(t, "gzip", bytes.Repeat([]byte("a"), 101))
+
+	tests := []struct {
+		name     string
+		path     string
+		body     []byte
+		encoding string
+		status   int
+	}{
+		{"decoded over route limit", "/echo", overRoute, "gzip", http.StatusRequestEntityTooLarge},
+		{"decoded over decompression limit", "/upload", bomb, "gzip", http.StatusRequestEntityTooLarge},
+		{"invalid stream", "/echo", []byte("not gzip"), "gzip", http.StatusBadRequest},
+		{"unsupported encoding", "/echo", []byte("data"), "br", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := bodyRequest(r, tt.path, tt.body, tt.encoding, false)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+
+	rr := bodyRequest(r, "/echo", []byte("data"), "br", false)
+	if got := rr.Header().Get("Accept-Encoding"); got != "gzip, deflate" {
+		t.Errorf("Expected Accept-Encoding to list the supported codings, got %q", got)
+	}
+}
+
+func TestBodyLimitDisabled(t *testing.T) {
+	cfg := testBodyConfig()
+	cfg.Decompress = false
+	r := newBodyRouter(cfg)
+	data := compressed(t, "gzip", []byte("hello"))
+
+	rr := bodyRequest(r, "/echo", data, "gzip", false)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), data) {
+		t.Errorf("Expected the encoded body to pass through, got %d", rr.Code)
+	}
+
+	r = newBodyRouter(config.RequestBodyConfig{Enabled: false})
+	if rr := bodyRequest(r, "/echo", bytes.Repeat([]byte("a"), 1000), "", true); rr.Code != http.StatusOK {
+		t.Errorf("Expected no limit when disabled, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/dxas90/learn-go/internal/config"
+)
+
+// CacheControl sets the configured Cache-Control policy of each route
+type CacheControl struct {
+	enabled bool
+	def     string
+	routes  map[string]string
+}
+
+// NewCacheControl creates a CacheControl middleware from the configuration
+func NewCacheControl(cfg config.CacheConfig) *CacheControl {
+	return &CacheControl{enabled: cfg.Enabled, def: cfg.Default, routes: cfg.Routes}
+}
+
+// Middleware sets Cache-Control to the policy of the matched route
+// template, or the default one, before calling next so that handlers can
+// still override it
+func (c *CacheControl) Middleware(next http.Handler) http.Handler {
+	if !c.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.def
+		if route, ok := routeTemplate(r); ok {
+			if p, ok := c.routes[route]; ok {
+				policy = p
+			}
+		}
+		if policy != "" {
+			w.Header().Set("Cache-Control", policy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/gorilla/mux"
+)
+
+func newCacheRouter(cfg config.CacheConfig) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(NewCacheControl(cfg).Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/version", ok)
+	r.HandleFunc("/echo", ok)
+	r.HandleFunc("/custom", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private")
+	})
+	return r
+}
+
+func TestCacheControl(t *testing.T) {
+	r := newCacheRouter(config.CacheConfig{
+		Enabled: true,
+		Default: "no-store",
+		Routes:  map[string]string{"/version": "public, max-age=60"},
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/version", "public, max-age=60"},
+		{"/echo", "no-store"},
+		{"/custom", "private"},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if got := rr.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("Expected Cache-Control %q for %s, got %q", tt.want, tt.path, got)
+		}
+	}
+}
+
+func TestCacheControlDisabled(t *testing.T) {
+	for _, cfg := range []config.CacheConfig{
+		{Enabled: false, Default: "no-store"},
+		{Enabled: true},
+	} {
+		rr := httptest.NewRecorder()
+		newCacheRouter(cfg).ServeHTTP(rr, httptest.NewRequest("GET", "/echo", nil))
+		if got := rr.Header().Get("Cache-Control"); got != "" {
+			t.Errorf("Expected no Cache-Control for %+v, got %q", cfg, got)
+		}
+	}
+}
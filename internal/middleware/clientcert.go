@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/dxas90/learn-go/internal/identity"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientCertMiddleware exposes the verified TLS client certificate of a
+// request as its identity (see identity.FromContext). Requests without a
+// verified certificate pass through unchanged.
+func ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// VerifiedChains is only populated once the chain checked out against the client CAs
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id := identity.FromCertificate(r.TLS.VerifiedChains[0][0])
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("enduser.id", id.Subject))
+
+		next.ServeHTTP(w, r.WithContext(identity.NewContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/identity"
+)
+
+func TestClientCertMiddleware(t *testing.T) {
+	var got *identity.Identity
+	handler := ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = identity.FromContext(r.Context())
+	}))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client-a"}}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got == nil || got.Subject != "client-a" || got.Method != identity.MethodClientCert {
+		t.Errorf("Expected client-a identity, got %+v", got)
+	}
+}
+
+func TestClientCertMiddlewareUnverified(t *testing.T) {
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+	}{
+		{"plaintext", nil},
+		{"no certificate", &tls.ConnectionState{}},
+		{"unverified certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found bool
+			handler := ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, found = identity.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.TLS = tt.state
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if found {
+				t.Error("Expected no identity")
+			}
+		})
+	}
+}
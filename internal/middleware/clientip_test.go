@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.1:5000", "", "", "203.0.113.1"},
+		{"untrusted peer ignores header", "203.0.113.1:5000", "198.51.100.1", "", "203.0.113.1"},
+		{"trusted peer uses header", "10.1.2.3:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"skips trusted hops", "192.0.2.1:5000", "198.51.100.1, 10.0.0.9", "", "198.51.100.1"},
+		{"spoofed prefix is ignored", "10.1.2.3:5000", "1.1.1.1, 198.51.100.1", "", "198.51.100.1"},
+		{"all hops trusted", "10.1.2.3:5000", "10.0.0.1", "", "10.0.0.1"},
+		{"real ip header", "10.1.2.3:5000", "", "198.51.100.2", "198.51.100.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := ClientIP(req, trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an error for an invalid proxy")
+	}
+}
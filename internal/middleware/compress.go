@@ -0,0 +1,268 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/compress"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/internal/negotiate"
+)
+
+// Compressor compresses response bodies with the content coding the client
+// prefers among the configured ones
+type Compressor struct {
+	enabled  bool
+	encoders map[string]compress.Encoder
+	offers   []string
+	minSize  int
+	excluded []string
+	metrics  *metrics.Metrics
+}
+
+// NewCompressor creates a Compressor middleware from the configuration,
+// recording the compressed sizes in m
+func NewCompressor(cfg config.CompressionConfig, m *metrics.Metrics) (*Compressor, error) {
+	c := &Compressor{enabled: cfg.Enabled, encoders: make(map[string]compress.Encoder), minSize: cfg.MinSize, metrics: m}
+	if !cfg.Enabled {
+		return c, nil
+	}
+
+	for _, encoding := range cfg.Encodings {
+		enc, err := compress.New(encoding, compress.Level(cfg.Level))
+		if err != nil {
+			return nil, err
+		}
+		c.encoders[encoding] = enc
+		c.offers = append(c.offers, encoding)
+	}
+	// Listed last so that compression wins ties with identity
+	c.offers = append(c.offers, "identity")
+	for _, t := range cfg.ExcludedTypes {
+		c.excluded = append(c.excluded, strings.ToLower(t))
+	}
+	return c, nil
+}
+
+// Middleware negotiates a content coding from Accept-Encoding and
+// compresses the response with it. The body is buffered until MinSize
+// bytes are written, the handler flushes or the response ends, and is sent
+// uncompressed when it turns out small, already encoded, of an excluded
+// type, or a 204, 206 or 304 response.
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	if !c.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+
+		accept := r.Header.Get("Accept-Encoding")
+		if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" || strings.TrimSpace(accept) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		enc, ok := c.encoders[negotiate.Best(accept, c.offers)]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, c: c, enc: enc, status: http.StatusOK, out: countingWriter{w: w}}
+		next.ServeHTTP(cw, r)
+		if err := cw.close(); err != nil {
+			logging.FromContext(r.Context()).Warn("Failed to finish compressed response", "encoding", enc.Encoding(), "error", err)
+		}
+	})
+}
+
+// excludedType reports whether responses of contentType are sent uncompressed
+func (c *Compressor) excludedType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range c.excluded {
+		if t == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the status and the start of the body until it
+// can tell whether the response is worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	c       *Compressor
+	enc     compress.Encoder
+	status  int
+	started bool
+	decided bool
+	buf     []byte
+	zw      compress.Writer
+	in      int64
+	out     countingWriter
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	// 1xx informational responses are followed by the final header
+	if cw.decided || code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.started {
+		return
+	}
+	cw.status, cw.started = code, true
+	if !compressibleStatus(code) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		return cw.write(b)
+	}
+	cw.started = true
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) < cw.c.minSize {
+		return len(b), nil
+	}
+	if err := cw.decide(false); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush sends the buffered data, compressing it if the response qualifies
+// regardless of its size, so streamed responses reach the client promptly
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.started = true
+		cw.decide(false)
+	}
+	if cw.zw != nil {
+		cw.zw.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// write sends b through the compressor, if any
+func (cw *compressWriter) write(b []byte) (int, error) {
+	if cw.zw == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	n, err := cw.zw.Write(b)
+	cw.in += int64(n)
+	return n, err
+}
+
+// decide chooses between compressing and sending the body as is, writes
+// the header and sends the buffered body. final is set once the handler has
+// returned, when the whole body is known.
+func (cw *compressWriter) decide(final bool) error {
+	cw.decided = true
+	if cw.compressible(final) {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.enc.Encoding())
+		// A strong validator no longer identifies the bytes sent
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.zw = cw.enc.NewWriter(&cw.out)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.write(buf)
+	return err
+}
+
+// compressible reports whether the response should be compressed. Missing
+// content types are sniffed from the buffered body as net/http would,
+// since sniffing compressed bytes would give the wrong type.
+func (cw *compressWriter) compressible(final bool) bool {
+	h := cw.Header()
+	if !compressibleStatus(cw.status) || h.Get("Content-Encoding") != "" ||
+		strings.Contains(h.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	if final && len(cw.buf) < cw.c.minSize {
+		return false
+	}
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < cw.c.minSize {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		if len(cw.buf) == 0 {
+			return false
+		}
+		contentType = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", contentType)
+	}
+	return !cw.c.excludedType(contentType)
+}
+
+// close finishes the response once the handler has returned and records
+// the compression metrics
+func (cw *compressWriter) close() error {
+	if !cw.decided {
+		if !cw.started {
+			// Nothing was written; net/http sends an empty 200 response
+			return nil
+		}
+		if err := cw.decide(true); err != nil {
+			return err
+		}
+	}
+	if cw.zw == nil {
+		return nil
+	}
+
+	err := cw.zw.Close()
+	encoding := cw.enc.Encoding()
+	m := cw.c.metrics
+	m.CompressionInputBytesTotal.WithLabelValues(encoding).Add(float64(cw.in))
+	m.CompressionOutputBytesTotal.WithLabelValues(encoding).Add(float64(cw.out.n))
+	if cw.in > 0 {
+		m.CompressionRatio.WithLabelValues(encoding).Observe(float64(cw.out.n) / float64(cw.in))
+	}
+	return err
+}
+
+// compressibleStatus reports whether a response with the status code may
+// have its body compressed. Partial content ranges refer to the
+// uncompressed representation.
+func compressibleStatus(code int) bool {
+	return code != http.StatusNoContent && code != http.StatusPartialContent && code != http.StatusNotModified
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var compressBody = strings.Repeat(`{"message":"hello, compressed world"}`, 100)
+
+func newTestCompressor(t *testing.T, m *metrics.Metrics) *Compressor {
+	t.Helper()
+	cfg := config.Default().Compression
+	cfg.Encodings = []string{"zstd", "gzip", "deflate"}
+	c, err := NewCompressor(cfg, m)
+	if err != nil {
+		t.Fatalf("NewCompressor() returned an error: %v", err)
+	}
+	return c
+}
+
+func compressRequest(h http.Handler, method, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	return string(out)
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	h := newTestCompressor(t, newTestMetrics()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, compressBody)
+	}))
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"gzip", "gzip"},
+		{"gzip, deflate, zstd", "zstd"},
+		{"gzip;q=1, zstd;q=0.5", "gzip"},
+		{"br", ""},
+		{"*", "zstd"},
+		{"zstd;q=0, *;q=0.5", "gzip"},
+		{"identity", ""},
+		{"gzip;q=0.5, identity", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			rr := compressRequest(h, "GET", tt.accept)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tt.want {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.want, got)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+			}
+			if tt.want == "" && rr.Body.String() != compressBody {
+				t.Error("Expected the body to be sent uncompressed")
+			}
+		})
+	}
+}
+
+func TestCompressGzipBody(t *testing.T) {
+	m := newTestMetrics()
+	h := newTestCompressor(t, m).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "3700")
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, compressBody)
+	}))
+
+	in := m.CompressionInputBytesTotal.WithLabelValues("gzip")
+	before := testutil.ToFloat64(in)
+
+	rr := compressRequest(h, "GET", "gzip")
+
+	if got := gunzip(t, rr.Body.Bytes()); got != compressBody {
+		t.Error("Expected the decompressed body to match")
+	}
+	if got := rr.Header().Get("Content-Length"); got != "" {
+		t.Errorf("Expected Content-Length to be removed, got %q", got)
+	}
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Expected the sniffed Content-Type, got %q", got)
+	}
+	if got := rr.Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf("Expected a weak ETag, got %q", got)
+	}
+	if got := testutil.ToFloat64(in) - before; got != float64(len(compressBody)) {
+		t.Errorf("Expected %d input bytes counted, got %v", len(compressBody), got)
+	}
+}
+
+func TestCompressSkipped(t *testing.T) {
+	c := newTestCompressor(t, newTestMetrics())
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{"small body", "GET", map[string]string{"Content-Type": "application/json"}, http.StatusOK, `{"ok":true}`},
+		{"excluded type", "GET", map[string]string{"Content-Type": "image/png"}, http.StatusOK, compressBody},
+		{"excluded type with parameters", "GET", map[string]string{"Content-Type": "application/PDF; x=y"}, http.StatusOK, compressBody},
+		{"already encoded", "GET", map[string]string{"Content-Type": "application/json", "Content-Encoding": "br"}, http.StatusOK, compressBody},
+		{"no-transform", "GET", map[string]string{"Content-Type": "application/json", "Cache-Control": "no-transform"}, http.StatusOK, compressBody},
+		{"partial content", "GET", map[string]string{"Content-Type": "application/json"}, http.StatusPartialContent, compressBody},
+		{"head", "HEAD", map[string]string{"Content-Type": "application/json"}, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			rr := compressRequest(h, tt.method, "gzip")
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.header["Content-Encoding"] {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.header["Content-Encoding"], got)
+			}
+			if rr.Body.String() != tt.body {
+				t.Errorf("Expected the body unchanged, got %d bytes", rr.Body.Len())
+			}
+		})
+	}
+}
+
+func TestCompressStatusAndEmptyBody(t *testing.T) {
+	h := newTestCompressor(t, newTestMetrics()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+
+	rr := compressRequest(h, "GET", "gzip")
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", rr.Code)
+	}
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.Len() != 0 {
+		t.Errorf("Expected an empty uncompressed response, got %q", rr.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	var flushed int64
+	h := newTestCompressor(t, newTestMetrics()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		flushed = w.(*compressWriter).out.n
+		io.WriteString(w, "data: second\n\n")
+	}))
+
+	rr := compressRequest(h, "GET", "gzip")
+
+	if flushed == 0 {
+		t.Error("Expected compressed data to be sent on Flush")
+	}
+	if !rr.Flushed {
+		t.Error("Expected the underlying writer to be flushed")
+	}
+	if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Expected a flushed stream to be compressed regardless of size, got %q", got)
+	}
+	if got := gunzip(t, rr.Body.Bytes()); got != "data: first\n\ndata: second\n\n" {
+		t.Errorf("Unexpected stream %q", got)
+	}
+}
+
+func TestCompressDisabled(t *testing.T) {
+	c, err := NewCompressor(config.CompressionConfig{Enabled: false}, newTestMetrics())
+	if err != nil {
+		t.Fatalf("NewCompressor() returned an error: %v", err)
+	}
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, compressBody)
+	}))
+
+	rr := compressRequest(h, "GET", "gzip")
+	if rr.Header().Get("Content-Encoding") != "" || rr.Header().Get("Vary") != "" {
+		t.Errorf("Expected no compression headers when disabled, got %v", rr.Header())
+	}
+}
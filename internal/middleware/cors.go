@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/gorilla/mux"
+)
+
+// corsPolicy is a config.CORSPolicy prepared for matching
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   []wildcardOrigin
+	patterns    []*regexp.Regexp
+	methods     []string
+	headers     []string
+	anyHeader   bool
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// wildcardOrigin matches the subdomains of an origin such as https://*.example.com
+type wildcardOrigin struct {
+	prefix, suffix string
+}
+
+func newCORSPolicy(p config.CORSPolicy) (*corsPolicy, error) {
+	c := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     p.AllowedMethods,
+		exposed:     strings.Join(p.ExposedHeaders, ", "),
+		credentials: p.AllowCredentials != nil && *p.AllowCredentials,
+	}
+	if p.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+
+	for _, origin := range p.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://*.")
+			c.wildcards = append(c.wildcards, wildcardOrigin{prefix: scheme + "://", suffix: "." + host})
+		default:
+			c.origins[origin] = true
+		}
+	}
+	for _, pattern := range p.AllowedOriginPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CORS origin pattern %q: %w", pattern, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	for _, h := range p.AllowedHeaders {
+		if h == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers = append(c.headers, http.CanonicalHeaderKey(h))
+	}
+	return c, nil
+}
+
+// allows reports whether origin may make cross-origin requests
+func (c *corsPolicy) allows(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if c.origins[lower] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		sub, ok := strings.CutPrefix(lower, w.prefix)
+		if ok && strings.HasSuffix(sub, w.suffix) && len(sub) > len(w.suffix) &&
+			!strings.ContainsAny(strings.TrimSuffix(sub, w.suffix), "/:@") {
+			return true
+		}
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin.
+// Credentialed requests must name the origin rather than "*".
+func (c *corsPolicy) allowOrigin(origin string) string {
+	if c.anyOrigin && !c.credentials {
+		return "*"
+	}
+	return origin
+}
+
+// disallowedHeader returns the first requested header the policy does not allow
+func (c *corsPolicy) disallowedHeader(requested string) (string, bool) {
+	if c.anyHeader {
+		return "", false
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h != "" && !slices.Contains(c.headers, h) {
+			return h, true
+		}
+	}
+	return "", false
+}
+
+// CORS applies Cross-Origin Resource Sharing policies
+type CORS struct {
+	enabled bool
+	routes  *mux.Router
+	def     *corsPolicy
+	byRoute map[string]*corsPolicy
+}
+
+// NewCORS creates a CORS middleware from the configuration. routes is used
+// to find the route a preflight request is about; it may be nil, in which
+// case preflights always use the default policy.
+func NewCORS(cfg config.CORSConfig, routes *mux.Router) (*CORS, error) {
+	c := &CORS{enabled: cfg.Enabled, routes: routes, byRoute: make(map[string]*corsPolicy)}
+	if !cfg.Enabled {
+		return c, nil
+	}
+
+	def, err := newCORSPolicy(cfg.CORSPolicy)
+	if err != nil {
+		return nil, err
+	}
+	c.def = def
+	for route, override := range cfg.Routes {
+		p, err := newCORSPolicy(cfg.CORSPolicy.Merge(override))
+		if err != nil {
+			return nil, err
+		}
+		c.byRoute[route] = p
+	}
+	return c, nil
+}
+
+// Middleware applies the policy of the matched route template, or the
+// default policy, to cross-origin requests. Requests from disallowed
+// origins get a 403 problem. Preflight requests are answered with 204 when
+// the requested method and headers are allowed, and passed on to the
+// router otherwise, so preflights for unknown routes get a 404.
+// Same-origin requests and requests without an Origin header are not
+// affected.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	if !c.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if !c.def.anyOrigin || c.def.credentials || len(c.byRoute) > 0 {
+			addVary(h, "Origin")
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && requestMethod != "" {
+			c.preflight(w, r, next, origin, requestMethod)
+			return
+		}
+
+		policy := c.policy(routeTemplate(r))
+		if !policy.allows(origin) {
+			apierror.Error(w, r, http.StatusForbidden, "Origin "+origin+" is not allowed")
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", policy.allowOrigin(origin))
+		if policy.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if policy.exposed != "" {
+			h.Set("Access-Control-Expose-Headers", policy.exposed)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight answers a CORS preflight request for the route that would
+// serve requestMethod
+func (c *CORS) preflight(w http.ResponseWriter, r *http.Request, next http.Handler, origin, requestMethod string) {
+	h := w.Header()
+	addVary(h, "Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers")
+
+	route, ok := "", true
+	if c.routes != nil {
+		probe := r.Clone(r.Context())
+		probe.Method = requestMethod
+		var match mux.RouteMatch
+		if ok = c.routes.Match(probe, &match) && match.MatchErr == nil; ok {
+			route, _ = match.Route.GetPathTemplate()
+		}
+	}
+	if !ok {
+		// Let the router reply 404 or 405 as for any unmatched request
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	policy := c.policy(route, route != "")
+	if !policy.allows(origin) {
+		apierror.Error(w, r, http.StatusForbidden, "Origin "+origin+" is not allowed")
+		return
+	}
+	if !slices.Contains(policy.methods, requestMethod) {
+		apierror.Error(w, r, http.StatusForbidden, "Method "+requestMethod+" is not allowed for cross-origin requests")
+		return
+	}
+	requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+	if header, denied := policy.disallowedHeader(requestHeaders); denied {
+		apierror.Error(w, r, http.StatusForbidden, "Header "+header+" is not allowed for cross-origin requests")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", policy.allowOrigin(origin))
+	h.Set("Access-Control-Allow-Methods", strings.Join(policy.methods, ", "))
+	if requestHeaders != "" {
+		allowed := strings.Join(policy.headers, ", ")
+		if policy.anyHeader {
+			allowed = requestHeaders
+		}
+		h.Set("Access-Control-Allow-Headers", allowed)
+	}
+	if policy.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if policy.maxAge != "" {
+		h.Set("Access-Control-Max-Age", policy.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// policy returns the policy of the route template, or the default one
+func (c *CORS) policy(route string, matched bool) *corsPolicy {
+	if p, ok := c.byRoute[route]; matched && ok {
+		return p
+	}
+	return c.def
+}
+
+// sameOrigin reports whether origin names the host the request was sent to.
+// Browsers send Origin on same-origin POST requests too.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// addVary adds values to the Vary header unless already listed
+func addVary(h http.Header, values ...string) {
+	for _, v := range values {
+		listed := false
+		for _, existing := range h.Values("Vary") {
+			for _, field := range strings.Split(existing, ",") {
+				if strings.EqualFold(strings.TrimSpace(field), v) {
+					listed = true
+				}
+			}
+		}
+		if !listed {
+			h.Add("Vary", v)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/gorilla/mux"
+)
+
+func testCORSConfig() config.CORSConfig {
+	credentials := true
+	return config.CORSConfig{
+		Enabled: true,
+		CORSPolicy: config.CORSPolicy{
+			AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+			AllowedOriginPatterns: []string{`^https://pr-[0-9]+\.preview\.example\.net$`},
+			AllowedMethods:        []string{"GET", "POST"},
+			AllowedHeaders:        []string{"Content-Type", "Authorization"},
+			ExposedHeaders:        []string{"X-Request-ID"},
+			MaxAge:                10 * time.Minute,
+		},
+		Routes: map[string]config.CORSPolicy{
+			"/private/{id}": {
+				AllowedOrigins:   []string{"https://admin.example.com"},
+				AllowCredentials: &credentials,
+			},
+		},
+	}
+}
+
+// newCORSRouter wires the CORS middleware like the application router,
+// including the handlers for unmatched requests
+func newCORSRouter(t *testing.T, cfg config.CORSConfig) *mux.Router {
+	t.Helper()
+	r := mux.NewRouter()
+	cors, err := NewCORS(cfg, r)
+	if err != nil {
+		t.Fatalf("NewCORS() returned an error: %v", err)
+	}
+	r.Use(cors.Middleware)
+	r.NotFoundHandler = cors.Middleware(http.HandlerFunc(apierror.NotFound))
+	r.MethodNotAllowedHandler = cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Error(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}))
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	r.HandleFunc("/items", ok).Methods("GET", "POST", "DELETE")
+	r.HandleFunc("/private/{id}", ok).Methods("GET")
+	return r
+}
+
+func corsRequest(r http.Handler, method, path, origin string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	r := newCORSRouter(t, testCORSConfig())
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"https://api.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"http://api.example.org", false},
+		{"https://pr-42.preview.example.net", true},
+		{"https://pr-x.preview.example.net", false},
+		{"https://evil.example.com", false},
+		{"null", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			rr := corsRequest(r, "GET", "/items", tt.origin, nil)
+
+			if !tt.allowed {
+				if rr.Code != http.StatusForbidden {
+					t.Errorf("Expected status 403, got %d", rr.Code)
+				}
+				if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+					t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+				}
+				return
+			}
+			if rr.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.origin {
+				t.Errorf("Expected Access-Control-Allow-Origin %q, got %q", tt.origin, got)
+			}
+			if got := rr.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-ID" {
+				t.Errorf("Expected exposed headers, got %q", got)
+			}
+			if rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("Expected credentials not to be allowed by default")
+			}
+		})
+	}
+}
+
+func TestCORSNonCORSRequests(t *testing.T) {
+	r := newCORSRouter(t, testCORSConfig())
+
+	for name, origin := range map[string]string{"no origin": "", "same origin": "http://example.com"} {
+		t.Run(name, func(t *testing.T) {
+			rr := corsRequest(r, "POST", "/items", origin, nil)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+				t.Errorf("Expected no CORS headers, got %q", got)
+			}
+			if got := rr.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Expected Vary: Origin, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := newCORSRouter(t, testCORSConfig())
+
+	rr := corsRequest(r, "OPTIONS", "/items", "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, authorization",
+	})
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rr.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Content-Type, Authorization",
+		"Access-Control-Max-Age":       "600",
+	}
+	for key, value := range want {
+		if got := rr.Header().Get(key); got != value {
+			t.Errorf("Expected %s %q, got %q", key, value, got)
+		}
+	}
+	vary := strings.Join(rr.Header().Values("Vary"), ", ")
+	for _, v := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		if !strings.Contains(vary, v) {
+			t.Errorf("Expected Vary to list %s, got %q", v, vary)
+		}
+	}
+}
+
+func TestCORSPreflightRejected(t *testing.T) {
+	r := newCORSRouter(t, testCORSConfig())
+
+	tests := []struct {
+		name   string
+		path   string
+		origin string
+		method string
+		header string
+		status int
+	}{
+		{"unknown route", "/missing", "https://app.example.com", "GET", "", http.StatusNotFound},
+		{"method not served by route", "/private/1", "https://admin.example.com", "DELETE", "", http.StatusMethodNotAllowed},
+		{"disallowed origin", "/items", "https://evil.com", "GET", "", http.StatusForbidden},
+		{"method outside policy", "/items", "https://app.example.com", "DELETE", "", http.StatusForbidden},
+		{"header outside policy", "/items", "https://app.example.com", "POST", "X-Custom", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{"Access-Control-Request-Method": tt.method}
+			if tt.header != "" {
+				header["Access-Control-Request-Headers"] = tt.header
+			}
+			rr := corsRequest(r, "OPTIONS", tt.path, tt.origin, header)
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+				t.Errorf("Expected no Access-Control-Allow-Origin, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCORSRouteOverride(t *testing.T) {
+	r := newCORSRouter(t, testCORSConfig())
+
+	rr := corsRequest(r, "GET", "/private/1", "https://admin.example.com", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Expected credentials to be allowed, got %q", got)
+	}
+
+	// The route's origins replace the default ones
+	if rr := corsRequest(r, "GET", "/private/1", "https://app.example.com", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an origin only allowed by default, got %d", rr.Code)
+	}
+
+	rr = corsRequest(r, "OPTIONS", "/private/1", "https://admin.example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the preflight to use the route policy, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	cfg := config.Default().CORS
+	r := newCORSRouter(t, cfg)
+
+	rr := corsRequest(r, "GET", "/items", "https://anywhere.test", nil)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin *, got %q", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "" {
+		t.Errorf("Expected no Vary for a wildcard policy, got %q", got)
+	}
+}
+
+func TestCORSDisabled(t *testing.T) {
+	r := newCORSRouter(t, config.CORSConfig{Enabled: false})
+
+	rr := corsRequest(r, "GET", "/items", "https://evil.com", nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin header should not be set when CORS is disabled, got %v", got)
+	}
+}
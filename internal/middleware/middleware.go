@@ -1,108 +1,217 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"io"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
-	"github.com/dxas90/learn-go/internal/handlers"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/internal/telemetry"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/semconv/v1.37.0/httpconv"
 )
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture the status code and
+// the number of body bytes written
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		// 1xx informational responses are followed by the final header
+		rw.wroteHeader = code >= 200
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// LoggingMiddleware logs incoming HTTP requests with timestamp and user agent.
-// Logging is disabled when GO_ENV is set to "test" to avoid cluttering test output.
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if os.Getenv("GO_ENV") != "test" {
-			timestamp := time.Now().UTC().Format(time.RFC3339)
-			userAgent := r.Header.Get("User-Agent")
-			if userAgent == "" {
-				userAgent = "Unknown"
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush sends buffered data to the client if the underlying writer supports it
+func (rw *responseWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// RequestLoggerMiddleware stores a request-scoped logger in the request context.
+// The logger carries the method and path, and records logged with the request
+// context also carry the request, trace and span IDs (see logging.FromContext).
+func RequestLoggerMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqLogger := logger.With("method", r.Method, "path", r.URL.Path)
+			next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), reqLogger)))
+		})
+	}
+}
+
+// serverMetrics are the OpenTelemetry semantic-convention HTTP server
+// instruments recorded next to the Prometheus collectors
+var serverMetrics = newServerMetrics(telemetry.Meter())
+
+type httpServerMetrics struct {
+	duration httpconv.ServerRequestDuration
+	active   httpconv.ServerActiveRequests
+}
+
+func newServerMetrics(meter metric.Meter) httpServerMetrics {
+	// Instruments fall back to no-ops on error, which is only returned
+	// for invalid names
+	duration, _ := httpconv.NewServerRequestDuration(meter,
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10))
+	active, _ := httpconv.NewServerActiveRequests(meter)
+	return httpServerMetrics{duration: duration, active: active}
+}
+
+// requestAttrs returns the http.request.method and url.scheme attributes,
+// with methods outside the standard set reported as _OTHER
+func (httpServerMetrics) requestAttrs(r *http.Request) []attribute.KeyValue {
+	method := httpconv.RequestMethodOther
+	switch m := httpconv.RequestMethodAttr(r.Method); m {
+	case httpconv.RequestMethodConnect, httpconv.RequestMethodDelete, httpconv.RequestMethodGet,
+		httpconv.RequestMethodHead, httpconv.RequestMethodOptions, httpconv.RequestMethodPatch,
+		httpconv.RequestMethodPost, httpconv.RequestMethodPut, httpconv.RequestMethodTrace:
+		method = m
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return []attribute.KeyValue{
+		attribute.String("http.request.method", string(method)),
+		attribute.String("url.scheme", scheme),
+	}
+}
+
+// record records a finished request with its route template, if matched,
+// status code and, for server errors, the error type
+func (m httpServerMetrics) record(ctx context.Context, attrs []attribute.KeyValue, route string, status int, seconds float64) {
+	attrs = append(attrs, m.duration.AttrResponseStatusCode(status))
+	if route != "" {
+		attrs = append(attrs, m.duration.AttrRoute(route))
+	}
+	if status >= 500 {
+		attrs = append(attrs, m.duration.AttrErrorType(httpconv.ErrorTypeAttr(strconv.Itoa(status))))
+	}
+	m.duration.Inst().Record(ctx, seconds, metric.WithAttributes(attrs...))
+}
+
+// MetricsMiddleware records the request count, duration, sizes and
+// in-flight requests in m, with the trace ID of sampled requests as
+// exemplar, and the OpenTelemetry http.server.request.duration and
+// http.server.active_requests metrics. Request bodies without a
+// Content-Length are measured as they are read. Label values are bounded
+// as described in metricLabels, and each replaced one is counted in
+// http_metric_label_values_dropped_total.
+func MetricsMiddleware(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Skip metrics endpoint to avoid recursion
+			if r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
 			}
-			log.Printf("[INFO] %s %s %s - User-Agent: %s", timestamp, r.Method, r.URL.Path, userAgent)
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
-// CORSMiddleware adds Cross-Origin Resource Sharing (CORS) headers to responses.
-// The CORS_ORIGIN environment variable can be used to configure allowed origins.
-// Defaults to "*" (allow all origins) if not set.
-// Handles OPTIONS preflight requests automatically.
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := os.Getenv("CORS_ORIGIN")
-		if origin == "" {
-			origin = "*"
-		}
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-// SecurityHeadersMiddleware adds security-related HTTP headers to all responses.
-// Headers include:
-// - X-Content-Type-Options: nosniff
-// - X-Frame-Options: DENY
-// - X-XSS-Protection: 1; mode=block
-// - Referrer-Policy: strict-origin-when-cross-origin
-// - Content-Security-Policy: default-src 'self'
-func SecurityHeadersMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("X-XSS-Protection", "1; mode=block")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'")
-		next.ServeHTTP(w, r)
-	})
-}
-
-// MetricsMiddleware tracks Prometheus metrics for HTTP requests
-func MetricsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip metrics endpoint to avoid recursion
-		if r.URL.Path == "/metrics" {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		start := time.Now()
-		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
-
-		next.ServeHTTP(rw, r)
-
-		duration := time.Since(start).Seconds()
-		route := mux.CurrentRoute(r)
-		path := r.URL.Path
-		if route != nil {
-			if template, err := route.GetPathTemplate(); err == nil {
-				path = template
+
+			sm := serverMetrics
+			ctx := r.Context()
+			attrs := sm.requestAttrs(r)
+			active := metric.WithAttributes(attrs...)
+			sm.active.Inst().Add(ctx, 1, active)
+			defer sm.active.Inst().Add(ctx, -1, active)
+			// Deferred so that requests ending in a panic are not left in flight
+			m.RequestsInFlight.Inc()
+			defer m.RequestsInFlight.Dec()
+
+			requestSize := r.ContentLength
+			var body *countingReader
+			if requestSize < 0 && r.Body != nil && r.Body != http.NoBody {
+				body = &countingReader{ReadCloser: r.Body}
+				r.Body = body
+			}
+
+			// Counted before serving, so requests ending in a panic are too
+			template, _ := routeTemplate(r)
+			method, endpoint := metricLabels(m, r)
+			if method == metrics.OtherMethod {
+				m.LabelValuesDroppedTotal.WithLabelValues("method").Inc()
+			}
+			if endpoint == metrics.UnmatchedEndpoint || endpoint == metrics.OverflowEndpoint {
+				m.LabelValuesDroppedTotal.WithLabelValues("endpoint").Inc()
+			}
+
+			start := time.Now()
+			rw := newResponseWriter(w)
+
+			next.ServeHTTP(rw, r)
+
+			duration := time.Since(start).Seconds()
+			if body != nil {
+				requestSize = body.n
 			}
-		}
 
-		handlers.HTTPRequestDuration.WithLabelValues(r.Method, path).Observe(duration)
-		handlers.HTTPRequestsTotal.WithLabelValues(r.Method, path, strconv.Itoa(rw.statusCode)).Inc()
-	})
+			m.Observe(ctx, m.RequestDuration.WithLabelValues(method, endpoint), duration)
+			m.Inc(ctx, m.RequestsTotal.WithLabelValues(method, endpoint, strconv.Itoa(rw.statusCode)))
+			m.RequestSize.WithLabelValues(method, endpoint).Observe(float64(max(requestSize, 0)))
+			m.ResponseSize.WithLabelValues(method, endpoint).Observe(float64(rw.bytes))
+			sm.record(ctx, attrs, template, rw.statusCode, duration)
+		})
+	}
+}
+
+// metricLabels returns the method and endpoint labels of r, bounded by m:
+// unmatched requests share one endpoint, and unknown methods one method
+func metricLabels(m *metrics.Metrics, r *http.Request) (method, endpoint string) {
+	route, ok := routeTemplate(r)
+	return m.Method(r.Method), m.Endpoint(route, ok)
+}
+
+// routeTemplate returns the path template of the matched mux route
+func routeTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return template, true
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
 }
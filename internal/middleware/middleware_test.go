@@ -1,17 +1,42 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
-func TestLoggingMiddleware(t *testing.T) {
+// newTestMetrics returns collectors registered with a registry of their own
+func newTestMetrics() *metrics.Metrics {
+	return metrics.New(config.Default().Prometheus, prometheus.NewRegistry())
+}
+
+func TestRequestLoggerMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(config.LoggingConfig{Level: "info", Format: "json"}, &buf)
+
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).InfoContext(r.Context(), "handled")
 		w.WriteHeader(http.StatusOK)
 	})
 
-	testHandler := LoggingMiddleware(handler)
+	testHandler := RequestLoggerMiddleware(logger)(handler)
 	req := httptest.NewRequest("GET", "/", nil)
 	rr := httptest.NewRecorder()
 
@@ -21,44 +46,143 @@ func TestLoggingMiddleware(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusOK)
 	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse log line %q: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{"msg": "handled", "method": "GET", "path": "/"} {
+		if got := entry[key]; got != want {
+			t.Errorf("Expected log field %s=%q, got %v", key, want, got)
+		}
+	}
 }
 
-func TestCORSMiddleware(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+func TestMetricsMiddlewareSemconv(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	defer func(m httpServerMetrics) { serverMetrics = m }(serverMetrics)
+	serverMetrics = newServerMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+
+	r := mux.NewRouter()
+	r.Use(MetricsMiddleware(newTestMetrics()))
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
 	})
 
-	testHandler := CORSMiddleware(handler)
-	req := httptest.NewRequest("GET", "/", nil)
-	rr := httptest.NewRecorder()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/42", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/items/42", nil))
 
-	testHandler.ServeHTTP(rr, req)
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() returned an error: %v", err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	hist, ok := metrics["http.server.request.duration"].(metricdata.Histogram[float64])
+	if !ok || len(hist.DataPoints) != 2 {
+		t.Fatalf("Expected two http.server.request.duration series, got %+v", metrics["http.server.request.duration"])
+	}
+	var methods []string
+	for _, dp := range hist.DataPoints {
+		get := func(key string) string {
+			v, _ := dp.Attributes.Value(attribute.Key(key))
+			return v.Emit()
+		}
+		methods = append(methods, get("http.request.method"))
+		if get("http.route") != "/items/{id}" || get("http.response.status_code") != "503" ||
+			get("error.type") != "503" || get("url.scheme") != "http" {
+			t.Errorf("Unexpected attributes: %v", dp.Attributes.ToSlice())
+		}
+	}
+	slices.Sort(methods)
+	if !slices.Equal(methods, []string{"GET", "_OTHER"}) {
+		t.Errorf("Expected methods GET and _OTHER, got %v", methods)
+	}
 
-	if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
-		t.Errorf("Access-Control-Allow-Origin header is not correct: got %v want %v", origin, "*")
+	active, ok := metrics["http.server.active_requests"].(metricdata.Sum[int64])
+	if !ok || len(active.DataPoints) == 0 {
+		t.Fatalf("Expected http.server.active_requests, got %+v", metrics["http.server.active_requests"])
+	}
+	for _, dp := range active.DataPoints {
+		if dp.Value != 0 {
+			t.Errorf("Expected no active requests after completion, got %d", dp.Value)
+		}
 	}
 }
 
-func TestSecurityHeadersMiddleware(t *testing.T) {
-	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+func TestMetricsMiddlewareSizes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(config.Default().Prometheus, reg)
 
-	testHandler := SecurityHeadersMiddleware(handler)
-	req := httptest.NewRequest("GET", "/", nil)
-	rr := httptest.NewRecorder()
+	var inFlight float64
+	r := mux.NewRouter()
+	r.Use(MetricsMiddleware(m))
+	r.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = testutil.ToFloat64(m.RequestsInFlight)
+		io.Copy(w, r.Body)
+	})
 
-	testHandler.ServeHTTP(rr, req)
+	// A chunked body has no Content-Length, so it is counted as it is read
+	req := httptest.NewRequest("POST", "/echo", io.MultiReader(strings.NewReader("hello "), strings.NewReader("world")))
+	req.ContentLength = -1
+	r.ServeHTTP(httptest.NewRecorder(), req)
 
-	headers := map[string]string{
-		"X-Content-Type-Options": "nosniff",
-		"X-Frame-Options":        "DENY",
-		"X-XSS-Protection":       "1; mode=block",
+	if inFlight != 1 {
+		t.Errorf("Expected 1 request in flight while serving, got %v", inFlight)
+	}
+	if got := testutil.ToFloat64(m.RequestsInFlight); got != 0 {
+		t.Errorf("Expected no requests in flight after completion, got %v", got)
 	}
 
-	for key, value := range headers {
-		if headerValue := rr.Header().Get(key); headerValue != value {
-			t.Errorf("%s header is not correct: got %v want %v", key, headerValue, value)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() returned an error: %v", err)
+	}
+	sums := make(map[string]float64)
+	for _, mf := range families {
+		if h := mf.GetMetric()[0].GetHistogram(); h != nil {
+			sums[mf.GetName()] = h.GetSampleSum()
+		}
+	}
+	for _, name := range []string{"http_request_size_bytes", "http_response_size_bytes"} {
+		if sums[name] != 11 {
+			t.Errorf("Expected %s to observe 11 bytes, got %v", name, sums[name])
 		}
 	}
 }
+
+func TestMetricsMiddlewareBoundedLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(config.Default().Prometheus, reg)
+
+	r := mux.NewRouter()
+	r.Use(MetricsMiddleware(m))
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.NotFoundHandler = MetricsMiddleware(m)(http.NotFoundHandler())
+
+	for _, path := range []string{"/wp-admin.php", "/.env", "/cgi-bin/test.cgi"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PURGE", "/items/42", nil))
+
+	if got := testutil.ToFloat64(m.RequestsTotal.WithLabelValues("GET", metrics.UnmatchedEndpoint, "404")); got != 3 {
+		t.Errorf("Expected 3 unmatched requests, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.RequestsTotal.WithLabelValues(metrics.OtherMethod, "/items/{id}", "200")); got != 1 {
+		t.Errorf("Expected 1 request with an unknown method, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.RequestsTotal); got != 2 {
+		t.Errorf("Expected 2 series, got %d", got)
+	}
+	if got := testutil.ToFloat64(m.LabelValuesDroppedTotal.WithLabelValues("endpoint")); got != 3 {
+		t.Errorf("Expected 3 dropped endpoints, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.LabelValuesDroppedTotal.WithLabelValues("method")); got != 1 {
+		t.Errorf("Expected 1 dropped method, got %v", got)
+	}
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/identity"
+	"github.com/dxas90/learn-go/internal/logging"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/internal/ratelimit"
+)
+
+// Rate limit client key kinds
+const (
+	RateLimitKeyIP      = "ip"
+	RateLimitKeyAPIKey  = "api_key"
+	RateLimitKeySubject = "subject"
+)
+
+// defaultPolicyScope names the bucket shared by routes without a policy of their own
+const defaultPolicyScope = "default"
+
+// RateLimiter enforces token-bucket limits per client and route
+type RateLimiter struct {
+	cfg     config.RateLimitConfig
+	store   ratelimit.Store
+	trusted []*net.IPNet
+	metrics *metrics.Metrics
+}
+
+// NewRateLimiter creates a RateLimiter keeping its buckets in store and
+// counting rejections in m. trustedProxies lists the proxies whose
+// X-Forwarded-For header is used to determine the client address.
+func NewRateLimiter(cfg config.RateLimitConfig, trustedProxies []string, store ratelimit.Store, m *metrics.Metrics) (*RateLimiter, error) {
+	trusted, err := ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimiter{cfg: cfg, store: store, trusted: trusted, metrics: m}, nil
+}
+
+// Middleware applies the policy of the matched route template, or the
+// default policy, to each request. Every limited response carries
+// RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers; rejected requests get a 429 problem with Retry-After and are
+// counted in http_rate_limited_requests_total. Store failures let the request
+// through.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, matched := routeTemplate(r)
+		scope, policy := defaultPolicyScope, l.cfg.Default
+		if p, ok := l.cfg.Routes[route]; matched && ok {
+			scope, policy = "route:"+route, p
+		}
+		if policy.Requests == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		keyKind, clientKey := l.clientKey(r, policy)
+		limit := ratelimit.Limit{Requests: policy.Requests, Period: policy.Period}
+
+		res, err := l.store.Take(r.Context(), scope+"|"+keyKind+":"+clientKey, limit)
+		if err != nil {
+			logging.FromContext(r.Context()).WarnContext(r.Context(), "Rate limit store error, allowing request", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writeRateLimitHeaders(w.Header(), res, limit)
+		if !res.Allowed {
+			rejectRateLimited(w, r, l.metrics, keyKind, res, limit)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeRateLimitHeaders describes res in the RateLimit headers. When several
+// limits apply to a request, the one with the fewest remaining requests is
+// reported, unless res is a rejection, and RateLimit-Policy lists all of them.
+func writeRateLimitHeaders(h http.Header, res ratelimit.Result, limit ratelimit.Limit) {
+	h.Add("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+	if current, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && res.Allowed && current <= res.Remaining {
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+// rejectRateLimited counts the rejection in m and sends a 429 problem with
+// Retry-After
+func rejectRateLimited(w http.ResponseWriter, r *http.Request, m *metrics.Metrics, keyKind string, res ratelimit.Result, limit ratelimit.Limit) {
+	method, endpoint := metricLabels(m, r)
+	m.RateLimitedTotal.WithLabelValues(method, endpoint, keyKind).Inc()
+
+	retryAfter := max(ceilSeconds(res.RetryAfter), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	apierror.Error(w, r, http.StatusTooManyRequests,
+		fmt.Sprintf("Rate limit of %d requests per %s exceeded, retry in %d seconds", limit.Requests, limit.Period, retryAfter))
+}
+
+// clientKey returns the kind of key identifying the client and its value.
+// API keys are those authenticated by APIKeyAuthenticator, identified by
+// their ID; without one, and without a subject, the client IP is used.
+func (l *RateLimiter) clientKey(r *http.Request, policy config.RateLimitPolicy) (string, string) {
+	kind := policy.Key
+	if kind == "" {
+		kind = l.cfg.Key
+	}
+
+	switch kind {
+	case RateLimitKeyAPIKey:
+		if id, ok := identity.FromContext(r.Context()); ok && id.Method == identity.MethodAPIKey {
+			return RateLimitKeyAPIKey, id.KeyID
+		}
+	case RateLimitKeySubject:
+		if id, ok := identity.FromContext(r.Context()); ok && id.Subject != "" {
+			return RateLimitKeySubject, id.Method + ":" + id.Subject
+		}
+	}
+	return RateLimitKeyIP, ClientIP(r, l.trusted)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
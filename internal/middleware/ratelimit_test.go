@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/identity"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/dxas90/learn-go/internal/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func testRateLimitConfig() config.RateLimitConfig {
+	return config.RateLimitConfig{
+		Enabled: true,
+		Key:     RateLimitKeyIP,
+		Default: config.RateLimitPolicy{Requests: 5, Period: time.Minute},
+		Routes: map[string]config.RateLimitPolicy{
+			"/limited/{id}": {Requests: 2, Period: time.Minute},
+			"/open":         {},
+		},
+	}
+}
+
+func newRateLimitRouter(t *testing.T, cfg config.RateLimitConfig, store ratelimit.Store, m *metrics.Metrics) *mux.Router {
+	t.Helper()
+	limiter, err := NewRateLimiter(cfg, nil, store, m)
+	if err != nil {
+		t.Fatalf("NewRateLimiter() returned an error: %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }
+	r.HandleFunc("/limited/{id}", ok)
+	r.HandleFunc("/open", ok)
+	r.HandleFunc("/other", ok)
+	return r
+}
+
+func doRequest(r http.Handler, path, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRateLimiterRoutePolicy(t *testing.T) {
+	m := newTestMetrics()
+	r := newRateLimitRouter(t, testRateLimitConfig(), ratelimit.NewMemoryStore(), m)
+	before := testutil.ToFloat64(m.RateLimitedTotal.WithLabelValues("GET", "/limited/{id}", "ip"))
+
+	for i, want := range []string{"1", "0"} {
+		rr := doRequest(r, "/limited/1", "10.0.0.1:1234", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i, rr.Code)
+		}
+		if got := rr.Header().Get("RateLimit-Remaining"); got != want {
+			t.Errorf("Request %d: expected RateLimit-Remaining %s, got %s", i, want, got)
+		}
+		if got := rr.Header().Get("RateLimit-Limit"); got != "2" {
+			t.Errorf("Expected RateLimit-Limit 2, got %s", got)
+		}
+	}
+
+	// Different path values share the route template's bucket
+	rr := doRequest(r, "/limited/2", "10.0.0.1:1234", nil)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected problem content type, got %q", ct)
+	}
+	if ra := rr.Header().Get("Retry-After"); ra != "30" {
+		t.Errorf("Expected Retry-After 30, got %q", ra)
+	}
+	if policy := rr.Header().Get("RateLimit-Policy"); policy != "2;w=60" {
+		t.Errorf("Expected RateLimit-Policy 2;w=60, got %q", policy)
+	}
+
+	after := testutil.ToFloat64(m.RateLimitedTotal.WithLabelValues("GET", "/limited/{id}", "ip"))
+	if after != before+1 {
+		t.Errorf("Expected rejected counter to increase by 1, got %v -> %v", before, after)
+	}
+
+	// Another client has its own bucket, and the default policy is separate
+	if rr := doRequest(r, "/limited/1", "10.0.0.2:1234", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", rr.Code)
+	}
+	if rr := doRequest(r, "/other", "10.0.0.1:1234", nil); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "5" {
+		t.Errorf("Expected the default policy on /other, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+func TestRateLimiterUnlimitedRoute(t *testing.T) {
+	r := newRateLimitRouter(t, testRateLimitConfig(), ratelimit.NewMemoryStore(), newTestMetrics())
+
+	for i := 0; i < 10; i++ {
+		rr := doRequest(r, "/open", "10.0.0.1:1234", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected unlimited route to allow request %d, got %d", i, rr.Code)
+		}
+		if rr.Header().Get("RateLimit-Limit") != "" {
+			t.Error("Expected no rate limit headers on an unlimited route")
+		}
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		header http.Header
+		ctx    func(context.Context) context.Context
+	}{
+		{"api key", RateLimitKeyAPIKey, nil, func(ctx context.Context) context.Context {
+			return identity.NewContext(ctx, &identity.Identity{Method: identity.MethodAPIKey, Subject: "billing", KeyID: "key-1"})
+		}},
+		{"subject", RateLimitKeySubject, nil, func(ctx context.Context) context.Context {
+			return identity.NewContext(ctx, &identity.Identity{Method: "test", Subject: "alice"})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testRateLimitConfig()
+			cfg.Key = tt.key
+			limiter, err := NewRateLimiter(cfg, nil, ratelimit.NewMemoryStore(), newTestMetrics())
+			if err != nil {
+				t.Fatalf("NewRateLimiter() returned an error: %v", err)
+			}
+			handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			// The same client from different addresses shares one bucket
+			var last *httptest.ResponseRecorder
+			for i, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1", "10.0.0.4:1", "10.0.0.5:1", "10.0.0.6:1"} {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.RemoteAddr = addr
+				for k, v := range tt.header {
+					req.Header[k] = v
+				}
+				if tt.ctx != nil {
+					req = req.WithContext(tt.ctx(req.Context()))
+				}
+				last = httptest.NewRecorder()
+				handler.ServeHTTP(last, req)
+				if i < 5 && last.Code != http.StatusOK {
+					t.Fatalf("Request %d: expected status 200, got %d", i, last.Code)
+				}
+			}
+			if last.Code != http.StatusTooManyRequests {
+				t.Errorf("Expected the sixth request to be limited, got %d", last.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimiterUnauthenticatedAPIKeys(t *testing.T) {
+	cfg := testRateLimitConfig()
+	cfg.Key = RateLimitKeyAPIKey
+	r := newRateLimitRouter(t, cfg, ratelimit.NewMemoryStore(), newTestMetrics())
+
+	// Keys nobody authenticated do not get buckets of their own
+	var last *httptest.ResponseRecorder
+	for i := range 6 {
+		last = doRequest(r, "/other", "10.0.0.1:1234", http.Header{"X-Api-Key": {fmt.Sprintf("random-%d", i)}})
+		if i < 5 && last.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i, last.Code)
+		}
+	}
+	if last.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the sixth request from the same IP to be limited, got %d", last.Code)
+	}
+}
+
+// failingStore always returns an error
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("backend unavailable")
+}
+
+func TestRateLimiterStoreErrorFailsOpen(t *testing.T) {
+	r := newRateLimitRouter(t, testRateLimitConfig(), failingStore{}, newTestMetrics())
+
+	if rr := doRequest(r, "/limited/1", "10.0.0.1:1234", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected the request to be allowed when the store fails, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecoveryMiddleware recovers from panics in later handlers.
+// The panic and its stack are logged with the method, path and route, the
+// active span is marked as errored, m.PanicsTotal is incremented (the
+// request is also counted in m.RequestsTotal as a 500) and, unless the
+// response has already started, a 500 problem is sent.
+// requestIDHeader names the response header set by RequestIDMiddleware so
+// the ID can be included even though it is assigned further down the chain.
+func RecoveryMiddleware(requestIDHeader string, m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := newResponseWriter(w)
+
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				// http.ErrAbortHandler deliberately aborts the response
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				route, ok := routeTemplate(r)
+				if !ok {
+					route = r.URL.Path
+				}
+				requestID := w.Header().Get(requestIDHeader)
+				stack := debug.Stack()
+
+				slog.Default().ErrorContext(r.Context(), "Panic recovered",
+					"panic", fmt.Sprint(p),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"route", route,
+					"request_id", requestID,
+					"stack", string(stack),
+				)
+
+				span := trace.SpanFromContext(r.Context())
+				span.RecordError(fmt.Errorf("panic: %v", p))
+				span.SetStatus(codes.Error, "panic recovered")
+
+				// MetricsMiddleware never saw the request complete, so count it here
+				method, endpoint := metricLabels(m, r)
+				m.PanicsTotal.WithLabelValues(method, endpoint).Inc()
+				m.RequestsTotal.WithLabelValues(method, endpoint, strconv.Itoa(http.StatusInternalServerError)).Inc()
+
+				if rw.wroteHeader {
+					// Too late for an error response; abort so the client sees a failure
+					panic(http.ErrAbortHandler)
+				}
+
+				problem := apierror.New(http.StatusInternalServerError, "")
+				if requestID != "" {
+					problem.With(apierror.ExtensionRequestID, requestID)
+				}
+				// Drop headers describing the body the handler never finished
+				w.Header().Del("Content-Length")
+				w.Header().Del("Content-Encoding")
+				apierror.Write(w, r, problem)
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
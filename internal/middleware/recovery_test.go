@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newPanicRouter(m *metrics.Metrics) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(RecoveryMiddleware("X-Request-ID", m))
+	r.Use(RequestIDMiddleware(testRequestIDConfig))
+	r.HandleFunc("/panic/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		panic("something went wrong")
+	})
+	r.HandleFunc("/partial", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("too late")
+	})
+	return r
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	m := newTestMetrics()
+	before := testutil.ToFloat64(m.PanicsTotal.WithLabelValues("GET", "/panic/{id}"))
+
+	req := httptest.NewRequest("GET", "/panic/1", nil)
+	req.Header.Set("X-Request-ID", "panic-req")
+	rr := httptest.NewRecorder()
+
+	newPanicRouter(m).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Expected problem content type, got %q", ct)
+	}
+	if cl := rr.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("Expected stale Content-Length to be dropped, got %q", cl)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if response["status"] != float64(500) || response["title"] != "Internal Server Error" {
+		t.Errorf("Unexpected error response: %v", response)
+	}
+	if response["requestId"] != "panic-req" {
+		t.Errorf("Expected requestId='panic-req', got %v", response["requestId"])
+	}
+
+	after := testutil.ToFloat64(m.PanicsTotal.WithLabelValues("GET", "/panic/{id}"))
+	if after != before+1 {
+		t.Errorf("Expected panic counter to increase by 1, got %v -> %v", before, after)
+	}
+}
+
+func TestRecoveryMiddlewareAfterHeadersWritten(t *testing.T) {
+	req := httptest.NewRequest("GET", "/partial", nil)
+	rr := httptest.NewRecorder()
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler, got %v", p)
+		}
+		if rr.Code != http.StatusOK || rr.Body.String() != "partial" {
+			t.Errorf("Expected the partial response to be left untouched, got %d %q", rr.Code, rr.Body.String())
+		}
+	}()
+
+	newPanicRouter(newTestMetrics()).ServeHTTP(rr, req)
+}
+
+func TestRecoveryMiddlewareMarksSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	handler := otelhttp.NewHandler(newPanicRouter(newTestMetrics()), "test", otelhttp.WithTracerProvider(tp))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic/2", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("Expected span status Error, got %v", spans[0].Status())
+	}
+	if len(spans[0].Events()) == 0 {
+		t.Error("Expected the panic to be recorded as a span event")
+	}
+}
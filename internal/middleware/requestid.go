@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDAttribute is the span attribute holding the request ID
+const RequestIDAttribute = "request.id"
+
+// RequestIDMiddleware assigns a correlation ID to every request.
+// A valid ID received in the configured header is reused, otherwise a new
+// random ID is generated. The ID is stored in the request context (see
+// logging.RequestID), echoed in the response header and recorded on the
+// active OpenTelemetry span.
+func RequestIDMiddleware(cfg config.RequestIDConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(cfg.Header)
+			if !validRequestID(id, cfg.MaxLength) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(cfg.Header, id)
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String(RequestIDAttribute, id))
+
+			next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+// validRequestID reports whether a client-supplied ID is safe to reuse:
+// non-empty, at most maxLength bytes and limited to characters that cannot
+// break log lines or headers
+func validRequestID(id string, maxLength int) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=', c == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit hex-encoded ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
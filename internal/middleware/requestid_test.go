@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/logging"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var testRequestIDConfig = config.RequestIDConfig{Header: "X-Request-ID", MaxLength: 64}
+
+func TestRequestIDMiddlewareGeneratesID(t *testing.T) {
+	var ctxID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID = logging.RequestID(r.Context())
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+
+	RequestIDMiddleware(testRequestIDConfig)(handler).ServeHTTP(rr, req)
+
+	id := rr.Header().Get("X-Request-ID")
+	if len(id) != 32 {
+		t.Errorf("Expected a generated 32 character ID, got %q", id)
+	}
+	if ctxID != id {
+		t.Errorf("Expected context ID %q to match response header %q", ctxID, id)
+	}
+}
+
+func TestRequestIDMiddlewareReusesIncomingID(t *testing.T) {
+	cfg := config.RequestIDConfig{Header: "X-Correlation-ID", MaxLength: 64}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Correlation-ID", "abc-123_DEF.456")
+	rr := httptest.NewRecorder()
+
+	RequestIDMiddleware(cfg)(handler).ServeHTTP(rr, req)
+
+	if id := rr.Header().Get("X-Correlation-ID"); id != "abc-123_DEF.456" {
+		t.Errorf("Expected incoming ID to be echoed, got %q", id)
+	}
+}
+
+func TestRequestIDMiddlewareRejectsInvalidID(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, incoming := range []string{strings.Repeat("a", 65), "bad id", "bad\"id", "ünicode"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", incoming)
+		rr := httptest.NewRecorder()
+
+		RequestIDMiddleware(testRequestIDConfig)(handler).ServeHTTP(rr, req)
+
+		if id := rr.Header().Get("X-Request-ID"); id == incoming || id == "" {
+			t.Errorf("Expected invalid ID %q to be replaced, got %q", incoming, id)
+		}
+	}
+}
+
+func TestRequestIDMiddlewareSpanAttribute(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	handler := RequestIDMiddleware(testRequestIDConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	req := httptest.NewRequest("GET", "/", nil).WithContext(trace.ContextWithSpan(ctx, span))
+	req.Header.Set("X-Request-ID", "span-id-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	for _, attr := range spans[0].Attributes() {
+		if string(attr.Key) == RequestIDAttribute && attr.Value.AsString() == "span-id-1" {
+			return
+		}
+	}
+	t.Errorf("Expected span attribute %s=span-id-1, got %v", RequestIDAttribute, spans[0].Attributes())
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/csp"
+)
+
+// cspNoncePlaceholder is replaced with the request's nonce in CSP policies
+const cspNoncePlaceholder = "{nonce}"
+
+// SecurityHeaders adds the configured security headers to every response
+type SecurityHeaders struct {
+	enabled   bool
+	static    map[string]string
+	hsts      string
+	cspHeader string
+	csp       string
+	cspRoutes map[string]string
+}
+
+// NewSecurityHeaders creates a SecurityHeaders middleware from the configuration
+func NewSecurityHeaders(cfg config.SecurityConfig) *SecurityHeaders {
+	s := &SecurityHeaders{
+		enabled: cfg.Enabled,
+		static: map[string]string{
+			"X-Content-Type-Options":       "nosniff",
+			"X-Frame-Options":              cfg.FrameOptions,
+			"Referrer-Policy":              cfg.ReferrerPolicy,
+			"Permissions-Policy":           cfg.PermissionsPolicy,
+			"Cross-Origin-Opener-Policy":   cfg.CrossOriginOpenerPolicy,
+			"Cross-Origin-Embedder-Policy": cfg.CrossOriginEmbedderPolicy,
+			"Cross-Origin-Resource-Policy": cfg.CrossOriginResourcePolicy,
+		},
+		cspHeader: "Content-Security-Policy",
+		csp:       withReportURI(cfg.CSP.Policy, cfg.CSP.ReportURI),
+		cspRoutes: make(map[string]string, len(cfg.CSP.Routes)),
+	}
+	if cfg.CSP.ReportOnly {
+		s.cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	for route, policy := range cfg.CSP.Routes {
+		s.cspRoutes[route] = withReportURI(policy, cfg.CSP.ReportURI)
+	}
+
+	if cfg.HSTS.Enabled {
+		s.hsts = fmt.Sprintf("max-age=%d", int64(cfg.HSTS.MaxAge.Seconds()))
+		if cfg.HSTS.IncludeSubdomains {
+			s.hsts += "; includeSubDomains"
+		}
+		if cfg.HSTS.Preload {
+			s.hsts += "; preload"
+		}
+	}
+	return s
+}
+
+// Middleware sets the headers before calling next. Strict-Transport-Security
+// is only sent on TLS connections. The Content-Security-Policy is the one of
+// the matched route template, or the default one; when it contains the
+// "{nonce}" placeholder a fresh nonce is substituted and made available to
+// handlers through csp.Nonce.
+func (s *SecurityHeaders) Middleware(next http.Handler) http.Handler {
+	if !s.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for name, value := range s.static {
+			if value != "" {
+				h.Set(name, value)
+			}
+		}
+		if s.hsts != "" && r.TLS != nil {
+			h.Set("Strict-Transport-Security", s.hsts)
+		}
+
+		policy := s.csp
+		if route, ok := routeTemplate(r); ok {
+			if p, ok := s.cspRoutes[route]; ok {
+				policy = p
+			}
+		}
+		if strings.Contains(policy, cspNoncePlaceholder) {
+			nonce := newNonce()
+			policy = strings.ReplaceAll(policy, cspNoncePlaceholder, nonce)
+			r = r.WithContext(csp.NewContext(r.Context(), nonce))
+		}
+		if policy != "" {
+			h.Set(s.cspHeader, policy)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withReportURI appends a report-uri directive to a non-empty policy
+func withReportURI(policy, reportURI string) string {
+	if policy == "" || reportURI == "" || strings.Contains(policy, "report-uri") {
+		return policy
+	}
+	return strings.TrimRight(strings.TrimSpace(policy), ";") + "; report-uri " + reportURI
+}
+
+// newNonce returns 128 random bits encoded for use in a CSP nonce source
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/csp"
+	"github.com/gorilla/mux"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	handler := NewSecurityHeaders(config.Default().Security).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	headers := map[string]string{
+		"X-Content-Type-Options":       "nosniff",
+		"X-Frame-Options":              "DENY",
+		"Referrer-Policy":              "strict-origin-when-cross-origin",
+		"Permissions-Policy":           "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		"Cross-Origin-Opener-Policy":   "same-origin",
+		"Cross-Origin-Resource-Policy": "same-origin",
+		"Content-Security-Policy":      "default-src 'self'; report-uri /csp-report",
+	}
+	for key, value := range headers {
+		if headerValue := rr.Header().Get(key); headerValue != value {
+			t.Errorf("%s header is not correct: got %v want %v", key, headerValue, value)
+		}
+	}
+
+	// X-XSS-Protection is deprecated, COEP is off by default and HSTS needs TLS
+	for _, absent := range []string{"X-XSS-Protection", "Cross-Origin-Embedder-Policy", "Strict-Transport-Security"} {
+		if got := rr.Header().Get(absent); got != "" {
+			t.Errorf("Expected no %s header, got %q", absent, got)
+		}
+	}
+}
+
+func TestSecurityHeadersHSTS(t *testing.T) {
+	cfg := config.Default().Security
+	cfg.HSTS.Preload = true
+	handler := NewSecurityHeaders(cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains; preload" {
+		t.Errorf("Unexpected Strict-Transport-Security %q", got)
+	}
+}
+
+func TestSecurityHeadersRouteCSP(t *testing.T) {
+	cfg := config.Default().Security
+	cfg.CSP.ReportOnly = true
+	cfg.CSP.Routes = map[string]string{
+		"/docs": "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'",
+	}
+
+	var nonce string
+	r := mux.NewRouter()
+	r.Use(NewSecurityHeaders(cfg).Middleware)
+	r.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) { nonce = csp.Nonce(r.Context()) })
+	r.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/docs", nil))
+
+	policy := rr.Header().Get("Content-Security-Policy-Report-Only")
+	if nonce == "" || strings.Count(policy, "'nonce-"+nonce+"'") != 2 {
+		t.Errorf("Expected the nonce %q in both directives, got %q", nonce, policy)
+	}
+	if !strings.HasSuffix(policy, "; report-uri /csp-report") {
+		t.Errorf("Expected the report URI to be appended, got %q", policy)
+	}
+	if rr.Header().Get("Content-Security-Policy") != "" {
+		t.Error("Expected the policy not to be enforced in report-only mode")
+	}
+
+	first := nonce
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/docs", nil))
+	if nonce == first {
+		t.Error("Expected a fresh nonce per request")
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+	if got := rr.Header().Get("Content-Security-Policy-Report-Only"); got != "default-src 'self'; report-uri /csp-report" {
+		t.Errorf("Expected the default policy on other routes, got %q", got)
+	}
+}
+
+func TestSecurityHeadersDisabledValues(t *testing.T) {
+	cfg := config.Default().Security
+	cfg.FrameOptions = ""
+	cfg.CSP.Policy = ""
+	handler := NewSecurityHeaders(cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Header().Get("X-Frame-Options") != "" || rr.Header().Get("Content-Security-Policy") != "" {
+		t.Errorf("Expected empty headers not to be sent, got %v", rr.Header())
+	}
+}
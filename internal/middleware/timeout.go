@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/metrics"
+)
+
+// Timeout bounds how long handlers may take to produce a response
+type Timeout struct {
+	enabled bool
+	def     time.Duration
+	routes  map[string]time.Duration
+	header  string
+	status  int
+	metrics *metrics.Metrics
+}
+
+// NewTimeout creates a Timeout middleware from the configuration, counting
+// timed out requests in m
+func NewTimeout(cfg config.TimeoutConfig, m *metrics.Metrics) *Timeout {
+	return &Timeout{
+		enabled: cfg.Enabled,
+		def:     cfg.Default,
+		routes:  cfg.Routes,
+		header:  cfg.Header,
+		status:  cfg.Status,
+		metrics: m,
+	}
+}
+
+// Middleware gives the request context a deadline from the matched route
+// template's timeout, or the client's shorter one, and runs the handler
+// with its response buffered. When the deadline passes first the buffered
+// response is discarded, a problem with the configured status is sent and
+// the request is counted in http_request_timeouts_total; handlers
+// should stop working once the context is done. Routes without a timeout
+// are not buffered, so streaming handlers need one of zero.
+func (t *Timeout) Middleware(next http.Handler) http.Handler {
+	if !t.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, matched := routeTemplate(r)
+		timeout := t.def
+		if d, ok := t.routes[route]; matched && ok {
+			timeout = d
+		}
+
+		source := "route"
+		if v := r.Header.Get(t.header); t.header != "" && v != "" {
+			requested, err := parseTimeout(v)
+			if err != nil {
+				apierror.Error(w, r, http.StatusBadRequest, "Invalid "+t.header+" header: "+err.Error())
+				return
+			}
+			if timeout <= 0 || requested < timeout {
+				timeout, source = requested, "client"
+			}
+		}
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		// The handler starts from the headers outer middleware set, such as
+		// Vary, so that adding to them does not drop theirs
+		tw := &timeoutWriter{header: w.Header().Clone(), status: http.StatusOK}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					// Keep the handler's stack, which the re-panic below loses
+					if p != http.ErrAbortHandler {
+						p = fmt.Sprintf("%v\n\n%s", p, debug.Stack())
+					}
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// Handlers that stop when the context ends finish at the deadline too
+		switch ctx.Err() {
+		case nil:
+			dst := w.Header()
+			for k := range dst {
+				if _, ok := tw.header[k]; !ok {
+					delete(dst, k)
+				}
+			}
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+			w.WriteHeader(tw.status)
+			w.Write(tw.body.Bytes())
+		case context.DeadlineExceeded:
+			tw.timedOut = true
+			method, endpoint := metricLabels(t.metrics, r)
+			t.metrics.RequestTimeoutsTotal.WithLabelValues(method, endpoint, source).Inc()
+			apierror.Error(w, r, t.status, fmt.Sprintf("Request did not complete within %s", timeout))
+		default:
+			// The client went away; there is no one to reply to
+			tw.timedOut = true
+		}
+	})
+}
+
+// parseTimeout reads a timeout given in seconds or as a Go duration
+func parseTimeout(v string) (time.Duration, error) {
+	var d time.Duration
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+		d = time.Duration(seconds * float64(time.Second))
+	} else if d, err = time.ParseDuration(v); err != nil {
+		return 0, fmt.Errorf("expected seconds or a duration such as 500ms, got %q", v)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive, got %q", v)
+	}
+	return d, nil
+}
+
+// timeoutWriter buffers the handler's response until it completes in time.
+// Writes after the timeout fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	// 1xx informational responses cannot be buffered and are dropped
+	if tw.timedOut || tw.wroteHeader || code < http.StatusOK {
+		return
+	}
+	tw.status, tw.wroteHeader = code, true
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.body.Write(b)
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func testTimeoutConfig() config.TimeoutConfig {
+	return config.TimeoutConfig{
+		Enabled: true,
+		Default: 50 * time.Millisecond,
+		Routes: map[string]time.Duration{
+			"/stream": 0,
+		},
+		Header: "X-Request-Timeout",
+		Status: http.StatusServiceUnavailable,
+	}
+}
+
+// newTimeoutRouter serves /slow, which waits for its context to end, /fast
+// and /stream
+func newTimeoutRouter(cfg config.TimeoutConfig, m *metrics.Metrics) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(NewTimeout(cfg, m).Middleware)
+	r.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("late"))
+		}
+	})
+	r.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", "fast")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("done"))
+	})
+	r.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if _, ok := r.Context().Deadline(); ok {
+			w.WriteHeader(http.StatusConflict)
+		}
+	})
+	return r
+}
+
+func timeoutRequest(r http.Handler, path, requested string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if requested != "" {
+		req.Header.Set("X-Request-Timeout", requested)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTimeoutExceeded(t *testing.T) {
+	m := newTestMetrics()
+	r := newTimeoutRouter(testTimeoutConfig(), m)
+	counter := m.RequestTimeoutsTotal.WithLabelValues("GET", "/slow", "route")
+	before := testutil.ToFloat64(counter)
+
+	rr := timeoutRequest(r, "/slow", "")
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", rr.Code)
+	}
+	var problem map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to parse problem: %v", err)
+	}
+	if detail, _ := problem["detail"].(string); !strings.Contains(detail, "50ms") {
+		t.Errorf("Expected the timeout in the detail, got %q", detail)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("Expected 1 timeout counted, got %v", got)
+	}
+}
+
+func TestTimeoutCompleted(t *testing.T) {
+	r := newTimeoutRouter(testTimeoutConfig(), newTestMetrics())
+
+	rr := timeoutRequest(r, "/fast", "")
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rr.Code)
+	}
+	if rr.Header().Get("X-Handler") != "fast" || rr.Body.String() != "done" {
+		t.Errorf("Expected the handler's response, got %v %q", rr.Header(), rr.Body.String())
+	}
+}
+
+func TestTimeoutClientHeader(t *testing.T) {
+	m := newTestMetrics()
+	r := newTimeoutRouter(testTimeoutConfig(), m)
+	client := m.RequestTimeoutsTotal.WithLabelValues("GET", "/slow", "client")
+	before := testutil.ToFloat64(client)
+
+	start := time.Now()
+	rr := timeoutRequest(r, "/slow", "10ms")
+	if rr.Code != http.StatusServiceUnavailable || time.Since(start) >= 50*time.Millisecond {
+		t.Errorf("Expected the client timeout to apply, got %d after %s", rr.Code, time.Since(start))
+	}
+	if got := testutil.ToFloat64(client) - before; got != 1 {
+		t.Errorf("Expected the timeout to be counted for the client, got %v", got)
+	}
+
+	// Longer requested timeouts are capped at the route's
+	start = time.Now()
+	rr = timeoutRequest(r, "/slow", "10")
+	if rr.Code != http.StatusServiceUnavailable || time.Since(start) >= time.Second {
+		t.Errorf("Expected the route timeout to apply, got %d after %s", rr.Code, time.Since(start))
+	}
+
+	for _, v := range []string{"soon", "-1", "0"} {
+		if rr := timeoutRequest(r, "/fast", v); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for timeout %q, got %d", v, rr.Code)
+		}
+	}
+}
+
+func TestTimeoutDisabledForRoute(t *testing.T) {
+	r := newTimeoutRouter(testTimeoutConfig(), newTestMetrics())
+
+	if rr := timeoutRequest(r, "/stream", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected an unbuffered request without deadline, got %d", rr.Code)
+	}
+	// A client timeout still applies
+	if rr := timeoutRequest(r, "/stream", "1"); rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the client timeout to buffer the response, got %d", rr.Code)
+	}
+}
+
+func TestTimeoutStatus(t *testing.T) {
+	cfg := testTimeoutConfig()
+	cfg.Status = http.StatusGatewayTimeout
+	r := newTimeoutRouter(cfg, newTestMetrics())
+
+	if rr := timeoutRequest(r, "/slow", ""); rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", rr.Code)
+	}
+}
+
+func TestTimeoutPanicPropagates(t *testing.T) {
+	h := NewTimeout(testTimeoutConfig(), newTestMetrics()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	defer func() {
+		p := recover()
+		if p == nil || !strings.Contains(p.(string), "boom") {
+			t.Errorf("Expected the handler panic to be re-raised, got %v", p)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
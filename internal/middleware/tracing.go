@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing names the request span after the matched route and returns the
+// trace ID in a response header
+type Tracing struct {
+	header string
+}
+
+// NewTracing creates a Tracing middleware from the configuration
+func NewTracing(cfg config.TelemetryConfig) *Tracing {
+	return &Tracing{header: cfg.TraceIDHeader}
+}
+
+// SpanName returns the name of the server span of r: "METHOD route" once a
+// route matched, else the method. Methods outside the standard set are
+// named "HTTP", as the semantic conventions require, so that clients cannot
+// create arbitrary span names.
+func SpanName(r *http.Request) string {
+	method := r.Method
+	if !metrics.KnownMethod(method) {
+		method = "HTTP"
+	}
+	if route, ok := routeTemplate(r); ok {
+		return method + " " + route
+	}
+	return method
+}
+
+// Middleware renames the span started by otelhttp to "METHOD route" and
+// sets its http.route attribute, then sets the trace ID header. The header
+// is also set for incoming trace contexts when tracing is disabled.
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if route, ok := routeTemplate(r); ok {
+			span.SetName(SpanName(r))
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		if sc := span.SpanContext(); t.header != "" && sc.HasTraceID() {
+			w.Header().Set(t.header, sc.TraceID().String())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
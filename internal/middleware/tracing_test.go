@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newTracingHandler(header string, opts ...otelhttp.Option) http.Handler {
+	r := mux.NewRouter()
+	r.Use(NewTracing(config.TelemetryConfig{TraceIDHeader: header}).Middleware)
+	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	opts = append(opts, otelhttp.WithPropagators(propagation.TraceContext{}))
+	return otelhttp.NewHandler(r, "test", opts...)
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	handler := newTracingHandler("X-Trace-ID", otelhttp.WithTracerProvider(tp))
+
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /items/{id}" {
+		t.Errorf("Expected span name GET /items/{id}, got %s", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the incoming trace to be continued, got %s", got)
+	}
+	var route string
+	for _, kv := range span.Attributes() {
+		if kv.Key == attribute.Key("http.route") {
+			route = kv.Value.AsString()
+		}
+	}
+	if route != "/items/{id}" {
+		t.Errorf("Expected http.route /items/{id}, got %q", route)
+	}
+	if got := rr.Header().Get("X-Trace-ID"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the trace ID header, got %q", got)
+	}
+}
+
+func TestTracingMiddlewareHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		traceparent string
+		want        string
+	}{
+		{"incoming trace without tracing", "X-Trace-ID", testTraceparent, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"no trace", "X-Trace-ID", "", ""},
+		{"disabled", "", testTraceparent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTracingHandler(tt.header, otelhttp.WithTracerProvider(noop.NewTracerProvider()))
+			req := httptest.NewRequest("GET", "/items/42", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("X-Trace-ID"); got != tt.want {
+				t.Errorf("Expected X-Trace-ID %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSpanName(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/items/42", "GET /items/{id}"},
+		{"PURGE", "/items/42", "HTTP /items/{id}"},
+		{"GET", "/missing", "GET"},
+		{"FOOBAR", "/missing", "HTTP"},
+	}
+
+	for _, tt := range tests {
+		recorder := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		handler := newTracingHandler("", otelhttp.WithTracerProvider(tp),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return SpanName(r)
+			}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+		spans := recorder.Ended()
+		if len(spans) != 1 {
+			t.Fatalf("%s %s: expected 1 span, got %d", tt.method, tt.path, len(spans))
+		}
+		if got := spans[0].Name(); got != tt.want {
+			t.Errorf("%s %s: expected span name %q, got %q", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
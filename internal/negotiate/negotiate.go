@@ -0,0 +1,110 @@
+// Package negotiate implements HTTP proactive content negotiation for
+// Accept-style headers (Accept, Accept-Encoding) with quality values.
+package negotiate
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spec is one entry of an Accept-style header
+type Spec struct {
+	Value  string
+	Q      float64
+	Params map[string]string
+}
+
+// Parse splits an Accept-style header into its entries ordered by
+// decreasing quality. Entries with an invalid quality are ignored and
+// entries keep their header order when qualities are equal.
+func Parse(header string) []Spec {
+	var specs []Spec
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+
+		spec := Spec{Value: value, Q: 1}
+		valid := true
+		for _, param := range fields[1:] {
+			key, val, _ := strings.Cut(param, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			if key == "q" {
+				q, err := strconv.ParseFloat(val, 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+					break
+				}
+				spec.Q = q
+				continue
+			}
+			if spec.Params == nil {
+				spec.Params = make(map[string]string)
+			}
+			spec.Params[key] = val
+		}
+		if valid {
+			specs = append(specs, spec)
+		}
+	}
+
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].Q > specs[j].Q })
+	return specs
+}
+
+// Quality returns the quality the header assigns to offer, or 0 when the
+// offer is not acceptable. Media ranges (type/*, */*) and "*" match any
+// offer, with more specific entries taking precedence.
+func Quality(specs []Spec, offer string) float64 {
+	offer = strings.ToLower(offer)
+	best, bestSpecificity := 0.0, -1
+	for _, s := range specs {
+		specificity := match(s.Value, offer)
+		if specificity > bestSpecificity {
+			best, bestSpecificity = s.Q, specificity
+		}
+	}
+	return best
+}
+
+// Best returns the offer with the highest quality in header, preferring
+// earlier offers on ties. An empty header accepts the first offer. It
+// returns "" when no offer is acceptable.
+func Best(header string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+
+	specs := Parse(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := Quality(specs, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// match reports how specifically pattern matches offer: 2 for an exact
+// match, 1 for a type wildcard (text/*), 0 for a full wildcard (*/* or *)
+// and -1 for no match
+func match(pattern, offer string) int {
+	switch {
+	case pattern == offer:
+		return 2
+	case pattern == "*" || pattern == "*/*":
+		return 0
+	case strings.HasSuffix(pattern, "/*"):
+		if typ, _, ok := strings.Cut(offer, "/"); ok && typ == strings.TrimSuffix(pattern, "/*") {
+			return 1
+		}
+	}
+	return -1
+}
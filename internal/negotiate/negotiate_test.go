@@ -0,0 +1,68 @@
+package negotiate
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	specs := Parse("text/html;q=0.5, application/json, */*;q=0.1, bad;q=2, ")
+
+	if len(specs) != 3 {
+		t.Fatalf("Expected 3 entries, got %d: %v", len(specs), specs)
+	}
+	if specs[0].Value != "application/json" || specs[0].Q != 1 {
+		t.Errorf("Expected application/json first, got %+v", specs[0])
+	}
+	if specs[1].Value != "text/html" || specs[1].Q != 0.5 {
+		t.Errorf("Expected text/html second, got %+v", specs[1])
+	}
+	if specs[2].Value != "*/*" {
+		t.Errorf("Expected */* last, got %+v", specs[2])
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	specs := Parse(`application/json; charset="utf-8"; q=0.8`)
+	if len(specs) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(specs))
+	}
+	if specs[0].Params["charset"] != "utf-8" || specs[0].Q != 0.8 {
+		t.Errorf("Unexpected entry: %+v", specs[0])
+	}
+}
+
+func TestBest(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/plain"}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/*", "text/plain"},
+		{"*/*", "application/json"},
+		{"application/json;q=0.5, application/xml", "application/xml"},
+		{"application/*;q=0.5, application/xml;q=0", "application/json"},
+		{"image/png", ""},
+		{"gzip, br;q=0.9", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Best(tt.header, offers); got != tt.want {
+			t.Errorf("Best(%q) = %q, expected %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestQualityEncoding(t *testing.T) {
+	specs := Parse("gzip;q=0.5, *;q=0.1, identity;q=0")
+
+	if q := Quality(specs, "gzip"); q != 0.5 {
+		t.Errorf("Expected gzip q=0.5, got %v", q)
+	}
+	if q := Quality(specs, "br"); q != 0.1 {
+		t.Errorf("Expected br to match * with q=0.1, got %v", q)
+	}
+	if q := Quality(specs, "identity"); q != 0 {
+		t.Errorf("Expected identity q=0, got %v", q)
+	}
+}
@@ -0,0 +1,140 @@
+// Package ratelimit implements token-bucket rate limiting on top of a
+// pluggable Store, so buckets can live in process memory or in a backend
+// shared by every replica.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit describes a token bucket: it holds up to Requests tokens and
+// refills completely over Period
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// rate returns the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// Limit is the bucket capacity
+	Limit int
+	// Remaining is the number of whole tokens left after this request
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next token is available when the
+	// request was rejected
+	RetryAfter time.Duration
+}
+
+// Store holds the token buckets. Implementations must be safe for
+// concurrent use; a shared backend should apply Take atomically.
+type Store interface {
+	// Take removes one token from the bucket identified by key, creating a
+	// full bucket with the given limit if none exists
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of one token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket up to now and removes one token if available
+func (b *bucket) take(now time.Time, limit Limit) Result {
+	capacity := float64(limit.Requests)
+	rate := limit.rate()
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((capacity - b.tokens) / rate)
+	return res
+}
+
+// full reports whether the bucket would be full at now, in which case it is
+// indistinguishable from a new bucket
+func (b *bucket) full(now time.Time, limit Limit) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*limit.rate() >= float64(limit.Requests)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// MemoryStore keeps buckets in process memory. Limits are therefore per
+// replica. Buckets that have refilled completely are evicted periodically.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*entry
+	now       func() time.Time
+	lastSweep time.Time
+	sweepEach time.Duration
+}
+
+type entry struct {
+	bucket
+	limit Limit
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*entry),
+		now:       time.Now,
+		sweepEach: time.Minute,
+	}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= s.sweepEach {
+		s.sweep(now)
+	}
+
+	e, ok := s.buckets[key]
+	if !ok || e.limit != limit {
+		e = &entry{bucket: bucket{tokens: float64(limit.Requests), last: now}, limit: limit}
+		s.buckets[key] = e
+	}
+	return e.take(now, limit), nil
+}
+
+// Len returns the number of buckets currently held
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// sweep evicts buckets that have refilled completely
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, e := range s.buckets {
+		if e.full(now, e.limit) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
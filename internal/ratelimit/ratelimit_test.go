@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store whose clock is advanced manually
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	s, now := newTestStore()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	ctx := context.Background()
+
+	for i := 2; i >= 0; i-- {
+		res, err := s.Take(ctx, "client", limit)
+		if err != nil {
+			t.Fatalf("Take() returned an error: %v", err)
+		}
+		if !res.Allowed || res.Remaining != i {
+			t.Errorf("Expected allowed with %d remaining, got %+v", i, res)
+		}
+		if res.Limit != 3 {
+			t.Errorf("Expected limit 3, got %d", res.Limit)
+		}
+	}
+
+	res, _ := s.Take(ctx, "client", limit)
+	if res.Allowed {
+		t.Fatal("Expected the fourth request to be rejected")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("Expected RetryAfter 1s, got %v", res.RetryAfter)
+	}
+	if res.Reset != 3*time.Second {
+		t.Errorf("Expected Reset 3s, got %v", res.Reset)
+	}
+
+	// One token refills per second
+	*now = now.Add(time.Second)
+	if res, _ := s.Take(ctx, "client", limit); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Expected a refilled token, got %+v", res)
+	}
+
+	// Other keys have their own bucket
+	if res, _ := s.Take(ctx, "other", limit); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("Expected a separate bucket for another key, got %+v", res)
+	}
+}
+
+func TestMemoryStoreLimitChange(t *testing.T) {
+	s, _ := newTestStore()
+	ctx := context.Background()
+
+	s.Take(ctx, "client", Limit{Requests: 1, Period: time.Minute})
+	res, _ := s.Take(ctx, "client", Limit{Requests: 5, Period: time.Minute})
+	if !res.Allowed || res.Remaining != 4 {
+		t.Errorf("Expected a new bucket after the limit changed, got %+v", res)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s, now := newTestStore()
+	limit := Limit{Requests: 2, Period: time.Second}
+	ctx := context.Background()
+
+	s.Take(ctx, "a", limit)
+	s.Take(ctx, "b", limit)
+	if s.Len() != 2 {
+		t.Fatalf("Expected 2 buckets, got %d", s.Len())
+	}
+
+	*now = now.Add(2 * time.Minute)
+	s.Take(ctx, "c", limit)
+	if s.Len() != 1 {
+		t.Errorf("Expected refilled buckets to be evicted, got %d buckets", s.Len())
+	}
+}
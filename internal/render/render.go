@@ -0,0 +1,302 @@
+// Package render writes response bodies in the representation negotiated
+// from the Accept header or the ?format= query parameter: JSON, pretty
+// JSON, YAML, XML, CBOR or MessagePack. Values are rendered from their JSON
+// form, so every format uses the same member names.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/negotiate"
+	"github.com/dxas90/learn-go/pkg/models"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatParam is the query parameter overriding the Accept header
+const FormatParam = "format"
+
+// ErrNotAcceptable is returned when the client accepts none of the formats
+var ErrNotAcceptable = errors.New("no acceptable representation")
+
+// Format is a representation responses can be rendered in
+type Format struct {
+	// Name selects the format in the ?format= query parameter
+	Name string
+	// MediaType is sent as the Content-Type
+	MediaType string
+	// Aliases are other media types clients may ask for
+	Aliases []string
+	Marshal func(v any) ([]byte, error)
+}
+
+// Supported formats
+var (
+	JSON = Format{Name: "json", MediaType: "application/json", Marshal: marshalJSON("")}
+	// PrettyJSON is selected with ?format=pretty or the pretty media type
+	// parameter, as in "Accept: application/json; pretty=true"
+	PrettyJSON = Format{Name: "pretty", MediaType: "application/json", Marshal: marshalJSON("  ")}
+	YAML       = Format{Name: "yaml", MediaType: "application/yaml", Aliases: []string{"application/x-yaml", "text/yaml"}, Marshal: marshalYAML}
+	XML        = Format{Name: "xml", MediaType: "application/xml", Aliases: []string{"text/xml"}, Marshal: marshalXML}
+	CBOR       = Format{Name: "cbor", MediaType: "application/cbor", Marshal: marshalCBOR}
+	MsgPack    = Format{Name: "msgpack", MediaType: "application/msgpack", Aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, Marshal: marshalMsgPack}
+)
+
+// formats lists the formats in order of preference, JSON being the default
+var formats = []Format{JSON, PrettyJSON, YAML, XML, CBOR, MsgPack}
+
+// Formats returns the supported formats
+func Formats() []Format {
+	return slices.Clone(formats)
+}
+
+// MediaTypes returns the media types clients may ask for
+func MediaTypes() []string {
+	var types []string
+	for _, f := range formats {
+		if !slices.Contains(types, f.MediaType) {
+			types = append(types, f.MediaType)
+		}
+		types = append(types, f.Aliases...)
+	}
+	return types
+}
+
+// Lookup returns the format of an Accept header entry, which must name a
+// media type exactly
+func Lookup(spec negotiate.Spec) (Format, bool) {
+	for _, f := range formats {
+		if f.MediaType == spec.Value || slices.Contains(f.Aliases, spec.Value) {
+			if f.Name == JSON.Name {
+				if pretty, _ := strconv.ParseBool(spec.Params["pretty"]); pretty {
+					return PrettyJSON, true
+				}
+			}
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Negotiate selects the format named by the ?format= query parameter or,
+// without one, the one the Accept header prefers. A missing Accept header
+// selects JSON. It returns ErrNotAcceptable when no format qualifies.
+func Negotiate(r *http.Request) (Format, error) {
+	if name := r.URL.Query().Get(FormatParam); name != "" {
+		for _, f := range formats {
+			if f.Name == name {
+				return f, nil
+			}
+		}
+		return Format{}, ErrNotAcceptable
+	}
+
+	best := negotiate.Best(r.Header.Get("Accept"), MediaTypes())
+	if best == "" {
+		return Format{}, ErrNotAcceptable
+	}
+	if best == JSON.MediaType {
+		// Honor the pretty parameter of the entry selecting JSON
+		for _, s := range negotiate.Parse(r.Header.Get("Accept")) {
+			if s.Value == JSON.MediaType {
+				f, _ := Lookup(s)
+				return f, nil
+			}
+		}
+	}
+	f, _ := Lookup(negotiate.Spec{Value: best})
+	return f, nil
+}
+
+// Write sends v with status in the format negotiated for r. It returns an
+// error without writing anything when no format is acceptable or v cannot
+// be rendered.
+func Write(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	f, err := Negotiate(r)
+	if err != nil {
+		return err
+	}
+	return WriteFormat(w, f, status, v)
+}
+
+// WriteFormat sends v with status in the given format. It returns an error
+// without writing anything when v cannot be rendered.
+func WriteFormat(w http.ResponseWriter, f Format, status int, v any) error {
+	body, err := f.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("rendering %s: %w", f.Name, err)
+	}
+	h := w.Header()
+	if !slices.Contains(h.Values("Vary"), "Accept") {
+		h.Add("Vary", "Accept")
+	}
+	h.Set("Content-Type", f.MediaType)
+	w.WriteHeader(status)
+	w.Write(body)
+	return nil
+}
+
+func marshalJSON(indent string) func(v any) ([]byte, error) {
+	return func(v any) ([]byte, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", indent)
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+func marshalYAML(v any) ([]byte, error) {
+	generic, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+// cborMode sorts map keys so that equal values encode identically
+var cborMode, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+func marshalCBOR(v any) ([]byte, error) {
+	generic, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	return cborMode.Marshal(generic)
+}
+
+func marshalMsgPack(v any) ([]byte, error) {
+	generic, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(generic); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalXML renders objects as elements named after their members and
+// arrays as repeated item elements, inside a response root element, or
+// error for models.ErrorResponse. Members whose names are not valid XML
+// names become entry elements with a key attribute.
+func marshalXML(v any) ([]byte, error) {
+	root := "response"
+	switch v.(type) {
+	case models.ErrorResponse, *models.ErrorResponse:
+		root = "error"
+	}
+	generic, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXML(enc, xml.StartElement{Name: xml.Name{Local: root}}, generic); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// xmlName matches the names usable as XML element names as is
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func encodeXML(enc *xml.Encoder, start xml.StartElement, v any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !xmlName.MatchString(k) || strings.HasPrefix(strings.ToLower(k), "xml") {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+			if err := encodeXML(enc, child, t[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range t {
+			if err := encodeXML(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(t))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// normalize converts v to the maps, slices and scalars of its JSON form,
+// keeping integers as integers
+func normalize(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return numbers(generic), nil
+}
+
+// numbers replaces the json.Number values in v with int64, uint64 or
+// float64 values
+func numbers(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			t[k] = numbers(e)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = numbers(e)
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+			return u
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
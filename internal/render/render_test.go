@@ -0,0 +1,171 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dxas90/learn-go/pkg/models"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		target string
+		accept string
+		want   string
+	}{
+		{"/", "", "json"},
+		{"/", "*/*", "json"},
+		{"/", "application/json", "json"},
+		{"/", "application/json; pretty=true", "pretty"},
+		{"/", "application/yaml", "yaml"},
+		{"/", "text/yaml", "yaml"},
+		{"/", "text/html, application/xml;q=0.9", "xml"},
+		{"/", "application/cbor", "cbor"},
+		{"/", "application/x-msgpack", "msgpack"},
+		{"/", "application/json;q=0.5, application/cbor", "cbor"},
+		{"/?format=yaml", "application/json", "yaml"},
+		{"/?format=pretty", "", "pretty"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+
+		f, err := Negotiate(req)
+		if err != nil {
+			t.Errorf("%s with Accept %q: unexpected error %v", tt.target, tt.accept, err)
+		} else if f.Name != tt.want {
+			t.Errorf("%s with Accept %q: expected %s, got %s", tt.target, tt.accept, tt.want, f.Name)
+		}
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	for _, target := range []string{"/?format=toml", "/"} {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", "text/html, application/json;q=0")
+
+		if _, err := Negotiate(req); !errors.Is(err, ErrNotAcceptable) {
+			t.Errorf("%s: expected ErrNotAcceptable, got %v", target, err)
+		}
+	}
+}
+
+func testResponse() models.Response {
+	return models.Response{
+		Success: true,
+		Data: map[string]any{
+			"version": "1.0.0",
+			"total":   uint64(17179869184),
+			"headers": map[string]string{"X-Request-ID": "abc", "Not a name": "x"},
+			"items":   []int{1, 2},
+		},
+		Timestamp: "2024-01-02T03:04:05Z",
+	}
+}
+
+func TestFormats(t *testing.T) {
+	decoders := map[string]func([]byte, any) error{
+		"json":    json.Unmarshal,
+		"pretty":  json.Unmarshal,
+		"yaml":    yaml.Unmarshal,
+		"cbor":    cbor.Unmarshal,
+		"msgpack": msgpack.Unmarshal,
+	}
+
+	for name, decode := range decoders {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/?format="+name, nil)
+			rr := httptest.NewRecorder()
+
+			if err := Write(rr, req, http.StatusCreated, testResponse()); err != nil {
+				t.Fatalf("Write() returned an error: %v", err)
+			}
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected status 201, got %d", rr.Code)
+			}
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", rr.Header().Get("Vary"))
+			}
+
+			var body struct {
+				Success bool `json:"success" yaml:"success" msgpack:"success"`
+				Data    struct {
+					Total   uint64            `json:"total" yaml:"total" msgpack:"total"`
+					Headers map[string]string `json:"headers" yaml:"headers" msgpack:"headers"`
+				} `json:"data" yaml:"data" msgpack:"data"`
+				Timestamp string `json:"timestamp" yaml:"timestamp" msgpack:"timestamp"`
+			}
+			if err := decode(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode the %s body: %v", name, err)
+			}
+			if !body.Success || body.Data.Total != 17179869184 || body.Data.Headers["X-Request-ID"] != "abc" {
+				t.Errorf("Unexpected body: %+v", body)
+			}
+			if body.Timestamp != "2024-01-02T03:04:05Z" {
+				t.Errorf("Expected the timestamp member, got %q", body.Timestamp)
+			}
+		})
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	body, err := PrettyJSON.Marshal(testResponse())
+	if err != nil {
+		t.Fatalf("Marshal() returned an error: %v", err)
+	}
+	if !bytes.Contains(body, []byte("\n  \"success\": true")) {
+		t.Errorf("Expected indented JSON, got %s", body)
+	}
+}
+
+func TestXML(t *testing.T) {
+	body, err := XML.Marshal(testResponse())
+	if err != nil {
+		t.Fatalf("Marshal() returned an error: %v", err)
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Success bool `xml:"success"`
+		Data    struct {
+			Total   uint64 `xml:"total"`
+			Items   []int  `xml:"items>item"`
+			Headers struct {
+				RequestID string `xml:"X-Request-ID"`
+				Entries   []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"entry"`
+			} `xml:"headers"`
+		} `xml:"data"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("Failed to parse XML: %v\n%s", err, body)
+	}
+	if doc.XMLName.Local != "response" || !doc.Success || doc.Data.Total != 17179869184 {
+		t.Errorf("Unexpected document: %+v", doc)
+	}
+	if len(doc.Data.Items) != 2 || doc.Data.Headers.RequestID != "abc" {
+		t.Errorf("Expected items and headers, got %+v", doc.Data)
+	}
+	if e := doc.Data.Headers.Entries; len(e) != 1 || e[0].Key != "Not a name" || e[0].Value != "x" {
+		t.Errorf("Expected an entry element for an invalid name, got %+v", e)
+	}
+
+	body, _ = XML.Marshal(models.ErrorResponse{Error: true, Message: "bad", StatusCode: 400})
+	if !strings.Contains(string(body), "<error><error>true</error>") {
+		t.Errorf("Expected an error root element, got %s", body)
+	}
+}
@@ -1,58 +1,255 @@
 package router
 
 import (
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
+	"os"
+	"slices"
+	"strings"
 
+	"github.com/dxas90/learn-go/internal/apierror"
+	"github.com/dxas90/learn-go/internal/auth"
+	"github.com/dxas90/learn-go/internal/config"
 	"github.com/dxas90/learn-go/internal/handlers"
+	"github.com/dxas90/learn-go/internal/metrics"
 	"github.com/dxas90/learn-go/internal/middleware"
+	"github.com/dxas90/learn-go/internal/ratelimit"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
 // Router wraps the mux router with application-specific configuration
 type Router struct {
-	mux *mux.Router
+	mux      *mux.Router
+	admin    *mux.Router
+	handlers *handlers.Handlers
+	metrics  *metrics.Metrics
 }
 
-// NewRouter creates and configures a new Router instance.
+// NewRouter creates and configures a new Router instance from the given configuration.
 // It sets up all application routes and applies middleware.
 // Returns an error if handler initialization fails.
-func NewRouter() (*Router, error) {
+func NewRouter(cfg *config.Config) (*Router, error) {
 	r := mux.NewRouter()
 
+	// Collectors served on /metrics, kept out of the global default registry
+	m := metrics.New(cfg.Prometheus, prometheus.NewRegistry())
+
 	// Create handlers
-	h, err := handlers.NewHandlers()
+	h, err := handlers.NewHandlers(cfg, m)
 	if err != nil {
 		return nil, err
 	}
 
 	// Apply middleware (order matters!)
-	r.Use(middleware.LoggingMiddleware)
-	r.Use(middleware.CORSMiddleware)
-	r.Use(middleware.SecurityHeadersMiddleware)
-	r.Use(middleware.MetricsMiddleware)
-	// OpenTelemetry tracing middleware
-	r.Use(func(next http.Handler) http.Handler {
-		return otelhttp.NewHandler(next, "http-server")
-	})
+	// Tracing wraps the whole mux (see Handler) so every middleware sees the span
+	chain := []mux.MiddlewareFunc{
+		middleware.RecoveryMiddleware(cfg.RequestID.Header, m),
+		middleware.RequestIDMiddleware(cfg.RequestID),
+		middleware.NewTracing(cfg.Telemetry).Middleware,
+		middleware.ClientCertMiddleware,
+		middleware.RequestLoggerMiddleware(slog.Default()),
+	}
+	if cfg.AccessLog.Enabled {
+		accessLogCfg := cfg.AccessLog
+		if cfg.APIKeys.Enabled && cfg.APIKeys.QueryParam != "" {
+			accessLogCfg.RedactQuery = append(slices.Clone(accessLogCfg.RedactQuery), cfg.APIKeys.QueryParam)
+		}
+		accessLog, err := middleware.NewAccessLogger(accessLogCfg, cfg.Server.TrustedProxies, os.Stdout)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, accessLog.Middleware)
+	}
+	// Compression runs inside the access log so it records the bytes sent
+	compressor, err := middleware.NewCompressor(cfg.Compression, m)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, compressor.Middleware)
+	cacheControl := middleware.NewCacheControl(cfg.Cache)
+	cors, err := middleware.NewCORS(cfg.CORS, r)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain,
+		cors.Middleware,
+		middleware.NewSecurityHeaders(cfg.Security).Middleware,
+		cacheControl.Middleware,
+		middleware.MetricsMiddleware(m),
+	)
+	// Authentication and rate limiting run inside MetricsMiddleware so their
+	// rejections are counted; the limiter needs the authenticated subject
+	if cfg.Auth.Enabled {
+		verifier, err := auth.NewVerifier(cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, middleware.AuthMiddleware(verifier))
+	}
+	limits := ratelimit.NewMemoryStore()
+	if keys := h.APIKeyStore(); keys != nil {
+		chain = append(chain, middleware.NewAPIKeyAuthenticator(cfg.APIKeys, keys, limits, m).Middleware)
+	}
+	if cfg.RateLimit.Enabled {
+		limiter, err := middleware.NewRateLimiter(cfg.RateLimit, cfg.Server.TrustedProxies, limits, m)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, limiter.Middleware)
+	}
+	// Bodies are only read once the client has been let through
+	bodyLimiter := middleware.NewBodyLimiter(cfg.RequestBody)
+	chain = append(chain, bodyLimiter.Middleware)
+	// Innermost, so the timeout response passes through the other middleware
+	chain = append(chain, middleware.NewTimeout(cfg.Timeout, m).Middleware)
+	r.Use(chain...)
+
+	// mux does not run middleware for unmatched requests, so wrap these explicitly
+	r.NotFoundHandler = wrap(http.HandlerFunc(apierror.NotFound), chain)
+	r.MethodNotAllowedHandler = wrap(methodNotAllowed(r), chain)
 
 	// Routes
 	r.HandleFunc("/", h.Index).Methods("GET")
 	r.HandleFunc("/ping", h.Ping).Methods("GET")
-	r.HandleFunc("/healthz", h.Healthz).Methods("GET")
-	r.HandleFunc("/info", h.Info).Methods("GET")
 	r.HandleFunc("/version", h.Version).Methods("GET")
-	r.HandleFunc("/echo", h.Echo).Methods("POST")
-	r.HandleFunc("/metrics", h.Metrics).Methods("GET")
+	r.Handle("/echo", secured(cfg, h.Echo, "echo:write")).Methods("POST")
 	r.HandleFunc("/openapi.json", h.OpenAPISpec).Methods("GET")
 	r.HandleFunc("/openapi.yaml", h.OpenAPISpecYAML).Methods("GET")
+	r.HandleFunc("/csp-report", h.CSPReport).Methods("POST")
+
+	// Operational endpoints move to the admin listener when it is enabled
+	admin := newAdminMux(cfg, h, m, compressor.Middleware, cacheControl.Middleware, bodyLimiter.Middleware)
+	if !cfg.Admin.Enabled {
+		registerOperationalRoutes(r, h)
+	}
 
 	return &Router{
-		mux: r,
+		mux:      r,
+		admin:    admin,
+		handlers: h,
+		metrics:  m,
 	}, nil
 }
 
+// secured requires the given scopes for h when JWT or API key
+// authentication is enabled
+func secured(cfg *config.Config, h http.HandlerFunc, scopes ...string) http.Handler {
+	if !cfg.Auth.Enabled && !cfg.APIKeys.Enabled {
+		return h
+	}
+	return middleware.RequireScopes(scopes...)(h)
+}
+
+// newAdminMux creates the router served by the admin listener: metrics,
+// probes, /info, admin operations and, if enabled, pprof profiles.
+// shared are the public router's middleware that also apply to it.
+func newAdminMux(cfg *config.Config, h *handlers.Handlers, m *metrics.Metrics, shared ...mux.MiddlewareFunc) *mux.Router {
+	a := mux.NewRouter()
+
+	chain := append([]mux.MiddlewareFunc{
+		middleware.RecoveryMiddleware(cfg.RequestID.Header, m),
+		middleware.RequestIDMiddleware(cfg.RequestID),
+		middleware.RequestLoggerMiddleware(slog.Default()),
+	}, shared...)
+	a.Use(chain...)
+	a.NotFoundHandler = wrap(http.HandlerFunc(apierror.NotFound), chain)
+	a.MethodNotAllowedHandler = wrap(methodNotAllowed(a), chain)
+
+	registerOperationalRoutes(a, h)
+	a.HandleFunc("/admin/log-level", h.LogLevel).Methods("GET", "PUT")
+	if h.APIKeyStore() != nil {
+		a.HandleFunc("/admin/api-keys", h.ListAPIKeys).Methods("GET")
+		a.HandleFunc("/admin/api-keys", h.CreateAPIKey).Methods("POST")
+		a.HandleFunc("/admin/api-keys/{id}", h.RevokeAPIKey).Methods("DELETE")
+	}
+
+	if cfg.Admin.Pprof {
+		a.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		a.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		a.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		a.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		// Index also serves the named profiles (heap, goroutine, ...)
+		a.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	}
+	return a
+}
+
+// registerOperationalRoutes adds the metrics, probe and info endpoints
+func registerOperationalRoutes(r *mux.Router, h *handlers.Handlers) {
+	r.HandleFunc("/healthz", h.Healthz).Methods("GET")
+	r.HandleFunc("/livez", h.Livez).Methods("GET")
+	r.HandleFunc("/readyz", h.Readyz).Methods("GET")
+	r.HandleFunc("/startupz", h.Startupz).Methods("GET")
+	r.HandleFunc("/info", h.Info).Methods("GET")
+	r.HandleFunc("/metrics", h.Metrics).Methods("GET")
+}
+
+// Handler returns the HTTP handler serving the router, wrapped in
+// OpenTelemetry tracing so that a span covers every middleware. Spans are
+// named by middleware.SpanName until the tracing middleware knows the route. The
+// HTTP server metrics are recorded by the metrics middleware instead.
+func (r *Router) Handler() http.Handler {
+	return otelhttp.NewHandler(r.mux, "http-server",
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return middleware.SpanName(req)
+		}),
+		otelhttp.WithMeterProvider(noop.NewMeterProvider()))
+}
+
+// AdminHandler returns the HTTP handler for the admin listener.
+// It is not traced to keep scrapes and probes out of the traces.
+func (r *Router) AdminHandler() http.Handler {
+	return r.admin
+}
+
 // Mux returns the underlying mux.Router instance
 func (r *Router) Mux() *mux.Router {
 	return r.mux
 }
+
+// Handlers returns the handlers serving the application routes
+func (r *Router) Handlers() *handlers.Handlers {
+	return r.handlers
+}
+
+// Metrics returns the collectors served on /metrics
+func (r *Router) Metrics() *metrics.Metrics {
+	return r.metrics
+}
+
+// wrap applies the middleware chain to h in the same order as mux.Router.Use
+func wrap(h http.Handler, chain []mux.MiddlewareFunc) http.Handler {
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+// methodNotAllowed replies with a 405 problem listing the methods the
+// matched path supports in the Allow header
+func methodNotAllowed(r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var allowed []string
+		for _, method := range []string{
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+			http.MethodPatch, http.MethodDelete, http.MethodOptions,
+		} {
+			probe := req.Clone(req.Context())
+			probe.Method = method
+			// Match succeeds with a MatchErr when it falls back to the error handlers
+			var match mux.RouteMatch
+			if r.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
+
+		allow := strings.Join(allowed, ", ")
+		w.Header().Set("Allow", allow)
+		apierror.Error(w, req, http.StatusMethodNotAllowed,
+			"Method "+req.Method+" is not allowed for "+req.URL.Path+"; allowed: "+allow)
+	})
+}
@@ -1,14 +1,22 @@
 package router
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
+	"github.com/dxas90/learn-go/internal/config"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func TestNewRouter(t *testing.T) {
-	r, err := NewRouter()
+	r, err := NewRouter(config.Default())
 	if err != nil {
 		t.Fatalf("NewRouter() returned an error: %v", err)
 	}
@@ -24,6 +32,9 @@ func TestNewRouter(t *testing.T) {
 		{"GET", "/"},
 		{"GET", "/ping"},
 		{"GET", "/healthz"},
+		{"GET", "/livez"},
+		{"GET", "/readyz"},
+		{"GET", "/startupz"},
 		{"GET", "/info"},
 		{"GET", "/version"},
 		{"POST", "/echo"},
@@ -32,8 +43,289 @@ func TestNewRouter(t *testing.T) {
 	for _, route := range routes {
 		req := httptest.NewRequest(route.method, route.path, nil)
 		var match mux.RouteMatch
-		if !r.mux.Match(req, &match) {
+		if !r.mux.Match(req, &match) || match.MatchErr != nil {
 			t.Errorf("route not registered: %s %s", route.method, route.path)
 		}
 	}
 }
+
+func TestUnmatchedRoutes(t *testing.T) {
+	r, err := NewRouter(config.Default())
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"not found", "GET", "/missing", http.StatusNotFound, ""},
+		{"method not allowed", "DELETE", "/echo", http.StatusMethodNotAllowed, "POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Request-ID", "unmatched-1")
+			rr := httptest.NewRecorder()
+
+			r.Handler().ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Expected problem content type, got %q", ct)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Expected Allow=%q, got %q", tt.allow, allow)
+			}
+			// The middleware chain must run for unmatched requests too
+			if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("Expected security headers on unmatched requests")
+			}
+
+			var problem map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("Failed to parse JSON: %v", err)
+			}
+			if problem["status"] != float64(tt.status) || problem["instance"] != tt.path {
+				t.Errorf("Unexpected problem: %v", problem)
+			}
+			if problem["requestId"] != "unmatched-1" {
+				t.Errorf("Expected requestId='unmatched-1', got %v", problem["requestId"])
+			}
+		})
+	}
+}
+
+func TestEchoRequiresAuth(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Enabled = true
+	cfg.Auth.Algorithms = []string{"HS256"}
+	cfg.Auth.HMACSecret = "0123456789abcdef0123456789abcdef"
+
+	r, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/echo", strings.NewReader(`{"a":1}`)))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for anonymous echo, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/ping", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected public routes to stay anonymous, got %d", rr.Code)
+	}
+}
+
+func TestEchoWithAPIKey(t *testing.T) {
+	cfg := config.Default()
+	cfg.APIKeys.Enabled = true
+	cfg.APIKeys.File = filepath.Join(t.TempDir(), "api-keys.json")
+
+	r, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+	_, writer, _ := r.Handlers().APIKeyStore().Create("writer", []string{"echo:write"}, nil, nil)
+	_, reader, _ := r.Handlers().APIKeyStore().Create("reader", nil, nil, nil)
+
+	for _, tt := range []struct {
+		key    string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{reader, http.StatusForbidden},
+		{writer, http.StatusOK},
+	} {
+		req := httptest.NewRequest("POST", "/echo", strings.NewReader(`{"a":1}`))
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		rr := httptest.NewRecorder()
+		r.Handler().ServeHTTP(rr, req)
+		if rr.Code != tt.status {
+			t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/admin/api-keys", nil)
+	var match mux.RouteMatch
+	if !r.admin.Match(req, &match) || match.MatchErr != nil {
+		t.Error("Expected the API key admin routes on the admin listener")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r, err := NewRouter(config.Default())
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		method string
+		status int
+	}{
+		{"/echo", "POST", http.StatusNoContent},
+		{"/ping", "GET", http.StatusNoContent},
+		{"/missing", "GET", http.StatusNotFound},
+		{"/ping", "DELETE", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("OPTIONS", tt.path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", tt.method)
+		rr := httptest.NewRecorder()
+		r.Handler().ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("Preflight %s %s: expected status %d, got %d", tt.method, tt.path, tt.status, rr.Code)
+		}
+	}
+}
+
+func TestOpenAPISpecCompressed(t *testing.T) {
+	r, err := NewRouter(config.Default())
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br;q=0.5")
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip, got %q", got)
+	}
+	if !strings.Contains(strings.Join(rr.Header().Values("Vary"), ", "), "Accept-Encoding") {
+		t.Errorf("Expected Vary to list Accept-Encoding, got %v", rr.Header().Values("Vary"))
+	}
+}
+
+func TestVaryWithTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.CORS.AllowedOrigins = []string{"https://app.example.com"}
+	cfg.Compression.MinSize = 0
+	r, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		status int
+	}{
+		{"GET", http.StatusOK},
+		{"DELETE", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Origin", "https://app.example.com")
+		rr := httptest.NewRecorder()
+		r.Handler().ServeHTTP(rr, req)
+
+		if rr.Code != tt.status {
+			t.Fatalf("%s /: expected status %d, got %d", tt.method, tt.status, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("%s /: expected Content-Encoding gzip, got %q", tt.method, got)
+		}
+		vary := strings.Join(rr.Header().Values("Vary"), ", ")
+		for _, want := range []string{"Accept", "Accept-Encoding", "Origin"} {
+			if !slices.Contains(strings.Split(vary, ", "), want) {
+				t.Errorf("%s /: expected Vary to list %s, got %q", tt.method, want, vary)
+			}
+		}
+	}
+}
+
+func TestEchoBodyLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.RequestBody.Routes = map[string]int64{"/echo": 16}
+	r, err := NewRouter(cfg)
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/echo", strings.NewReader(`{"message":"too long for the limit"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("Expected a problem response, got %q", got)
+	}
+}
+
+func TestOpenAPISpecConditional(t *testing.T) {
+	r, err := NewRouter(config.Default())
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, req)
+
+	etag := rr.Header().Get("ETag")
+	if !strings.HasPrefix(etag, "W/") {
+		t.Errorf("Expected a weak ETag for the compressed response, got %q", etag)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Expected the route's Cache-Control policy, got %q", got)
+	}
+
+	// The weak tag of the compressed response still validates the cached copy
+	req = httptest.NewRequest("GET", "/openapi.json", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no Content-Encoding on a 304, got %q", got)
+	}
+}
+
+func TestTraceIDHeader(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	r, err := NewRouter(config.Default())
+	if err != nil {
+		t.Fatalf("NewRouter() returned an error: %v", err)
+	}
+
+	// Unmatched requests run the middleware chain too
+	for _, path := range []string{"/ping", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		rr := httptest.NewRecorder()
+		r.Handler().ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("X-Trace-ID"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected the incoming trace ID on %s, got %q", path, got)
+		}
+	}
+}
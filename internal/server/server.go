@@ -1,47 +1,224 @@
 package server
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/metrics"
 	"github.com/dxas90/learn-go/internal/router"
 )
 
+// ShutdownFunc releases a resource when the server shuts down,
+// such as flushing the OpenTelemetry tracer provider
+type ShutdownFunc func(ctx context.Context) error
+
 // Server represents the HTTP server with its router
 type Server struct {
+	cfg    *config.Config
 	router *router.Router
+
+	// tlsConfig and certs are set when TLS is enabled
+	tlsConfig *tls.Config
+	certs     *certReloader
+
+	mu    sync.Mutex
+	hooks []ShutdownFunc
 }
 
 // NewServer creates a new Server instance with an initialized router.
-// Returns an error if router initialization fails.
-func NewServer() (*Server, error) {
-	r, err := router.NewRouter()
+// When TLS is enabled the certificates are loaded up front.
+// Returns an error if router initialization or TLS setup fails.
+func NewServer(cfg *config.Config) (*Server, error) {
+	r, err := router.NewRouter(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Server{
+	s := &Server{
+		cfg:    cfg,
 		router: r,
-	}, nil
+	}
+	if cfg.Server.TLS.Enabled {
+		if s.certs, err = newCertReloader(cfg.Server.TLS); err != nil {
+			return nil, err
+		}
+		if s.tlsConfig, err = newTLSConfig(cfg.Server.TLS, s.certs); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
-// Start starts the HTTP server on the specified address.
-// It configures timeouts and logs any errors that occur.
-// The server will block until it encounters an error or is shut down.
+// Metrics returns the collectors served on /metrics, whose registry other
+// collectors such as the OpenTelemetry Prometheus exporter register with
+func (s *Server) Metrics() *metrics.Metrics {
+	return s.router.Metrics()
+}
+
+// OnShutdown registers fn to run after in-flight requests have drained.
+// Functions run in registration order.
+func (s *Server) OnShutdown(fn ShutdownFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// Start starts the HTTP server on the specified address, and the admin
+// listener when it is enabled.
+// It blocks until SIGTERM or SIGINT is received and the graceful shutdown
+// has completed, or until the server fails.
 func (s *Server) Start(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("HTTP server error", "error", err)
+		return err
+	}
+
+	var adminLn net.Listener
+	if s.cfg.Admin.Enabled {
+		adminLn, err = net.Listen("tcp", s.cfg.Admin.Addr())
+		if err != nil {
+			slog.Error("Admin server error", "error", err)
+			ln.Close()
+			return err
+		}
+	}
+
+	return s.Serve(context.Background(), ln, adminLn)
+}
+
+// Serve accepts connections on ln, and admin connections on adminLn unless
+// it is nil, until ctx is cancelled or SIGTERM/SIGINT is received, then
+// shuts down gracefully:
+//
+//  1. readiness starts failing so load balancers stop sending traffic
+//  2. the server keeps serving for the configured shutdown delay
+//  3. in-flight requests are drained within the shutdown timeout
+//  4. the admin listener is closed, so probes and metrics stay available
+//     while the public listener drains
+//  5. registered OnShutdown functions run (e.g. flushing traces)
+//
+// When TLS is enabled connections on ln are served over TLS and the
+// certificates are reloaded from disk while the server runs. If either
+// listener fails, both are closed.
+// It returns nil after a clean shutdown.
+func (s *Server) Serve(ctx context.Context, ln, adminLn net.Listener) error {
 	srv := &http.Server{
-		Addr:         addr,
-		Handler:      s.router.Mux(),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Handler:      s.router.Handler(),
+		ReadTimeout:  s.cfg.Server.ReadTimeout,
+		WriteTimeout: s.cfg.Server.WriteTimeout,
+		IdleTimeout:  s.cfg.Server.IdleTimeout,
+		TLSConfig:    s.tlsConfig,
 	}
+	servers := []*http.Server{srv}
 
-	log.Printf("Starting HTTP server on %s", addr)
-	err := srv.ListenAndServe()
-	if err != nil {
-		log.Printf("HTTP server error: %v", err)
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if s.certs != nil && s.cfg.Server.TLS.ReloadInterval > 0 {
+		go s.certs.watch(ctx, s.cfg.Server.TLS.ReloadInterval)
 	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("Starting HTTP server", "address", ln.Addr().String(), "tls", s.tlsConfig != nil)
+		if s.tlsConfig != nil {
+			// Certificates come from TLSConfig.GetCertificate
+			serveErr <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		serveErr <- srv.Serve(ln)
+	}()
+
+	if adminLn != nil {
+		admin := &http.Server{
+			Handler:     s.router.AdminHandler(),
+			ReadTimeout: s.cfg.Server.ReadTimeout,
+			// No write timeout: CPU profiles and traces stream for their full duration
+			IdleTimeout: s.cfg.Server.IdleTimeout,
+		}
+		servers = append(servers, admin)
+		go func() {
+			slog.Info("Starting admin server", "address", adminLn.Addr().String())
+			serveErr <- admin.Serve(adminLn)
+		}()
+	}
+	// The listeners are already accepting connections, so startup is complete
+	s.router.Handlers().SetStarted(true)
+
+	select {
+	case err := <-serveErr:
+		slog.Error("HTTP server error", "error", err)
+		for _, srv := range servers {
+			srv.Close()
+		}
+		s.runHooks()
+		return err
+	case <-ctx.Done():
+	}
+	// Restore default signal handling so a second signal terminates immediately
+	stop()
+
+	slog.Info("Shutdown signal received, failing readiness")
+	s.router.Handlers().SetReady(false)
+
+	if delay := s.cfg.Server.ShutdownDelay; delay > 0 {
+		slog.Info("Waiting before draining connections", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	slog.Info("Draining connections", "timeout", s.cfg.Server.ShutdownTimeout)
+	var err error
+	for _, srv := range servers {
+		if serr := srv.Shutdown(drainCtx); serr != nil {
+			slog.Error("HTTP server shutdown error", "error", serr)
+			srv.Close()
+			err = errors.Join(err, serr)
+		}
+	}
+	for range servers {
+		if serr := <-serveErr; serr != nil && !errors.Is(serr, http.ErrServerClosed) {
+			err = errors.Join(err, serr)
+		}
+	}
+
+	if herr := s.runHooks(); herr != nil {
+		err = errors.Join(err, herr)
+	}
+
+	slog.Info("HTTP server stopped")
 	return err
 }
+
+// runHooks calls the registered shutdown functions, each bounded by the
+// configured shutdown timeout, and returns their joined errors
+func (s *Server) runHooks() error {
+	s.mu.Lock()
+	hooks := s.hooks
+	s.hooks = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, fn := range hooks {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Server.ShutdownTimeout)
+		if err := fn(ctx); err != nil {
+			slog.Error("Shutdown hook error", "error", err)
+			errs = append(errs, err)
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
@@ -1,13 +1,20 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
 )
 
 func TestNewServer(t *testing.T) {
-	s, err := NewServer()
+	s, err := NewServer(config.Default())
 	if err != nil {
 		t.Fatalf("NewServer() returned an error: %v", err)
 	}
@@ -18,7 +25,7 @@ func TestNewServer(t *testing.T) {
 }
 
 func TestServerStart(t *testing.T) {
-	s, err := NewServer()
+	s, err := NewServer(config.Default())
 	if err != nil {
 		t.Fatalf("NewServer() returned an error: %v", err)
 	}
@@ -42,3 +49,220 @@ func TestServerStart(t *testing.T) {
 		t.Errorf("Expected status OK, got %v", resp.Status)
 	}
 }
+
+// newTestServer returns a server listening on a random local port with a
+// short shutdown delay, plus a /slow route that blocks until release is closed
+func newTestServer(t *testing.T, release <-chan struct{}, started chan<- struct{}) (*Server, net.Listener) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Environment = "test"
+	cfg.Server.ShutdownDelay = 200 * time.Millisecond
+	cfg.Server.ShutdownTimeout = 5 * time.Second
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() returned an error: %v", err)
+	}
+
+	s.router.Mux().HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return s, ln
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s, ln := newTestServer(t, release, started)
+	baseURL := "http://" + ln.Addr().String()
+
+	var hookCalled atomic.Bool
+	s.OnShutdown(func(ctx context.Context) error {
+		hookCalled.Store(true)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+	go func() {
+		serveDone <- s.Serve(ctx, ln, nil)
+	}()
+
+	// Start an in-flight request that blocks until released
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	slowDone := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(baseURL + "/slow")
+		if err != nil {
+			slowDone <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slowDone <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Slow request never reached the handler")
+	}
+
+	// Trigger shutdown while the request is in flight
+	cancel()
+
+	// During the shutdown delay the server still accepts requests but fails readiness
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get(baseURL + "/healthz")
+		if err != nil {
+			t.Fatalf("Health check failed during shutdown delay: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected readiness to fail during shutdown, got %d", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+
+	res := <-slowDone
+	if res.err != nil {
+		t.Fatalf("In-flight request failed: %v", res.err)
+	}
+	if res.status != http.StatusOK || res.body != "done" {
+		t.Errorf("Expected in-flight request to complete with 200 'done', got %d %q", res.status, res.body)
+	}
+
+	select {
+	case err := <-serveDone:
+		if err != nil {
+			t.Errorf("Serve() returned an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return after shutdown")
+	}
+
+	if !hookCalled.Load() {
+		t.Error("Expected shutdown hook to be called")
+	}
+
+	if _, err := http.Get(baseURL + "/ping"); err == nil {
+		t.Error("Expected connections to be refused after shutdown")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s, ln := newTestServer(t, release, started)
+	s.cfg.Server.ShutdownDelay = 0
+	s.cfg.Server.ShutdownTimeout = 100 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+	go func() {
+		serveDone <- s.Serve(ctx, ln, nil)
+	}()
+
+	go http.Get("http://" + ln.Addr().String() + "/slow")
+	<-started
+	cancel()
+
+	select {
+	case err := <-serveDone:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not give up after the shutdown timeout")
+	}
+}
+
+func TestServeAdminListener(t *testing.T) {
+	cfg := config.Default()
+	cfg.Environment = "test"
+	cfg.Admin.Enabled = true
+	cfg.Admin.Pprof = true
+	cfg.Server.ShutdownDelay = 0
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() returned an error: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveDone := make(chan error, 1)
+	go func() {
+		serveDone <- s.Serve(ctx, ln, adminLn)
+	}()
+
+	public := "http://" + ln.Addr().String()
+	admin := "http://" + adminLn.Addr().String()
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{public + "/ping", http.StatusOK},
+		{public + "/metrics", http.StatusNotFound},
+		{public + "/readyz", http.StatusNotFound},
+		{admin + "/metrics", http.StatusOK},
+		{admin + "/readyz", http.StatusOK},
+		{admin + "/info", http.StatusOK},
+		{admin + "/admin/log-level", http.StatusOK},
+		{admin + "/debug/pprof/", http.StatusOK},
+		{admin + "/debug/pprof/goroutine?debug=1", http.StatusOK},
+		{admin + "/ping", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(tt.url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", tt.url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s: expected status %d, got %d", tt.url, tt.status, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-serveDone:
+		if err != nil {
+			t.Errorf("Serve() returned an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return after shutdown")
+	}
+
+	if _, err := http.Get(admin + "/metrics"); err == nil {
+		t.Error("Expected the admin listener to be closed after shutdown")
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+)
+
+// certReloader serves the certificate and client CA bundle from disk and
+// reloads them when the files change, e.g. when Kubernetes rotates a
+// mounted Secret. A failed reload keeps the previous material in use.
+type certReloader struct {
+	cfg config.TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	version   string
+}
+
+// newCertReloader loads the configured files, failing if they are unusable
+func newCertReloader(cfg config.TLSConfig) (*certReloader, error) {
+	c := &certReloader{cfg: cfg}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads the files again if they changed since the last load and
+// reports whether new material was installed
+func (c *certReloader) reload() (bool, error) {
+	version, err := c.fileVersion()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := version == c.version
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading TLS key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if c.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.cfg.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("reading client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificates found in client CA bundle %s", c.cfg.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	c.cert, c.clientCAs, c.version = &cert, pool, version
+	c.mu.Unlock()
+	return true, nil
+}
+
+// fileVersion summarizes the size and modification time of every file.
+// os.Stat follows symlinks, so the atomic symlink swap used for mounted
+// Secrets is detected as well.
+func (c *certReloader) fileVersion() (string, error) {
+	var version string
+	for _, path := range []string{c.cfg.CertFile, c.cfg.KeyFile, c.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		version += fmt.Sprintf("%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return version, nil
+}
+
+// watch reloads the files every interval until ctx is cancelled
+func (c *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				slog.Error("Failed to reload TLS certificates, keeping the current ones", "error", err)
+			} else if reloaded {
+				slog.Info("Reloaded TLS certificates", "cert_file", c.cfg.CertFile)
+			}
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+func (c *certReloader) getClientCAs() *x509.CertPool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clientCAs
+}
+
+// tlsVersions maps configured minimum versions to their tls constants
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// clientAuthTypes maps configured client_auth values to their tls constants
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":     tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+// newTLSConfig builds the listener TLS configuration. Certificates and
+// client CAs are resolved per handshake through the reloader.
+func newTLSConfig(cfg config.TLSConfig, reloader *certReloader) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q", cfg.MinVersion)
+	}
+	clientAuth, ok := clientAuthTypes[cfg.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("unsupported client auth mode %q", cfg.ClientAuth)
+	}
+	cipherSuites, err := parseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		// Listed explicitly so the per-client configs below keep offering HTTP/2
+		NextProtos:     []string{"h2", "http/1.1"},
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.getCertificate,
+	}
+	if clientAuth == tls.NoClientCert {
+		return base, nil
+	}
+
+	// ClientCAs has no callback, so hand out a config with the current pool
+	// for every handshake
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		conn := base.Clone()
+		conn.GetConfigForClient = nil
+		conn.ClientCAs = reloader.getClientCAs()
+		return conn, nil
+	}
+	return base, nil
+}
+
+// parseCipherSuites resolves cipher suite names, rejecting unknown and
+// insecure suites
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	var ids []uint16
+	var errs []error
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown or insecure cipher suite %q", name))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.Join(errs...)
+}
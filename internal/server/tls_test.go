@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/identity"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for commonName
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to path with a modification time far enough in the
+// future to be seen as a change regardless of file system timestamp precision
+func writeFile(t *testing.T, path string, data []byte, age time.Duration) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testTLSConfig writes a server certificate signed by ca and returns the
+// matching configuration
+func testTLSConfig(t *testing.T, ca *testCA) config.TLSConfig {
+	t.Helper()
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, "server", 2, x509.ExtKeyUsageServerAuth)
+
+	cfg := config.Default().Server.TLS
+	cfg.Enabled = true
+	cfg.CertFile = filepath.Join(dir, "tls.crt")
+	cfg.KeyFile = filepath.Join(dir, "tls.key")
+	cfg.ClientCAFile = filepath.Join(dir, "ca.crt")
+	writeFile(t, cfg.CertFile, certPEM, 0)
+	writeFile(t, cfg.KeyFile, keyPEM, 0)
+	writeFile(t, cfg.ClientCAFile, ca.pem, 0)
+	return cfg
+}
+
+func serialOf(t *testing.T, c *certReloader) int64 {
+	t.Helper()
+	cert, err := c.getCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := testTLSConfig(t, ca)
+
+	c, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatalf("newCertReloader() returned an error: %v", err)
+	}
+	if serial := serialOf(t, c); serial != 2 {
+		t.Fatalf("Expected serial 2, got %d", serial)
+	}
+
+	if reloaded, err := c.reload(); err != nil || reloaded {
+		t.Errorf("Expected no reload for unchanged files, got %v, %v", reloaded, err)
+	}
+
+	certPEM, keyPEM := ca.issue(t, "server", 3, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM, time.Minute)
+	writeFile(t, cfg.KeyFile, keyPEM, time.Minute)
+
+	if reloaded, err := c.reload(); err != nil || !reloaded {
+		t.Fatalf("Expected rotated files to be reloaded, got %v, %v", reloaded, err)
+	}
+	if serial := serialOf(t, c); serial != 3 {
+		t.Errorf("Expected serial 3 after rotation, got %d", serial)
+	}
+}
+
+func TestCertReloaderKeepsCertificateOnError(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := testTLSConfig(t, ca)
+
+	c, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatalf("newCertReloader() returned an error: %v", err)
+	}
+
+	// A half-written rotation: the key no longer matches the certificate
+	_, keyPEM := ca.issue(t, "server", 4, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.KeyFile, keyPEM, time.Minute)
+
+	if _, err := c.reload(); err == nil {
+		t.Error("Expected an error for a mismatched key pair")
+	}
+	if serial := serialOf(t, c); serial != 2 {
+		t.Errorf("Expected the previous certificate to stay in use, got serial %d", serial)
+	}
+}
+
+func TestNewTLSConfigInvalid(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := testTLSConfig(t, ca)
+	cfg.CipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_RC4_128_SHA"}
+
+	c, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatalf("newCertReloader() returned an error: %v", err)
+	}
+	if _, err := newTLSConfig(cfg, c); err == nil {
+		t.Error("Expected an error for an insecure cipher suite")
+	}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+
+	cfg := config.Default()
+	cfg.Environment = "test"
+	cfg.Server.ShutdownDelay = 0
+	cfg.Server.TLS = testTLSConfig(t, ca)
+	cfg.Server.TLS.ClientAuth = "require"
+
+	s, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() returned an error: %v", err)
+	}
+	s.router.Mux().HandleFunc("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := identity.FromContext(r.Context()); ok {
+			w.Write([]byte(id.Subject))
+		}
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, ln, nil) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	url := "https://" + ln.Addr().String() + "/whoami"
+
+	t.Run("with client certificate", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, "client-a", 10, x509.ExtKeyUsageClientAuth)
+		clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}},
+			ForceAttemptHTTP2: true,
+		}}
+
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+
+		if string(body) != "client-a" {
+			t.Errorf("Expected identity client-a, got %q", body)
+		}
+		if resp.ProtoMajor != 2 {
+			t.Errorf("Expected HTTP/2, got %s", resp.Proto)
+		}
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		}}
+
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			t.Error("Expected the handshake to fail without a client certificate")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// newExporter creates the span exporter selected in the configuration
+func newExporter(ctx context.Context, cfg config.TelemetryConfig) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "console":
+		return stdouttrace.New()
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &fileExporter{SpanExporter: exporter, file: f}, nil
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.UseTLS() {
+		var err error
+		if tlsConfig, err = newTLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Protocol == "http/protobuf" {
+		return newHTTPExporter(ctx, cfg, tlsConfig)
+	}
+	return newGRPCExporter(ctx, cfg, tlsConfig)
+}
+
+// newGRPCExporter creates an OTLP exporter over gRPC. TLS is disabled when
+// tlsConfig is nil.
+func newGRPCExporter(ctx context.Context, cfg config.TelemetryConfig, tlsConfig *tls.Config) (sdktrace.SpanExporter, error) {
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithHeaders(cfg.Headers),
+		otlptracegrpc.WithTimeout(cfg.Timeout),
+	}
+	if strings.Contains(cfg.OTLPEndpoint, "://") {
+		opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.OTLPEndpoint))
+	} else {
+		opts = append(opts, otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	if cfg.Compression == "gzip" {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
+	return otlptracegrpc.New(ctx, opts...)
+}
+
+// newHTTPExporter creates an OTLP exporter over HTTP with protobuf bodies.
+// Endpoint URLs without a path are sent to the default /v1/traces path.
+// TLS is disabled when tlsConfig is nil.
+func newHTTPExporter(ctx context.Context, cfg config.TelemetryConfig, tlsConfig *tls.Config) (sdktrace.SpanExporter, error) {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithHeaders(cfg.Headers),
+		otlptracehttp.WithTimeout(cfg.Timeout),
+	}
+	endpoint := cfg.OTLPEndpoint
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Trim(u.Path, "/") == "" {
+			endpoint = u.Host
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+			endpoint = ""
+		}
+	}
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	} else {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if cfg.Compression == "gzip" {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// newTLSConfig loads the CA verifying the collector, the system pool when
+// none is set, and the client certificate if any
+func newTLSConfig(cfg config.TelemetryTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading telemetry CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading telemetry client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// fileExporter writes spans as JSON lines to a file it closes on shutdown
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.file.Close())
+}
@@ -0,0 +1,206 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc/credentials"
+)
+
+// InstrumentationName identifies the instruments created by the service
+const InstrumentationName = "github.com/dxas90/learn-go"
+
+// Meter returns the meter handlers and middleware create their instruments
+// with. The instruments are exported by every configured metric exporter and
+// record nothing until InitMeter has run, so they can be created at package
+// initialization.
+func Meter() metric.Meter {
+	return otel.Meter(InstrumentationName)
+}
+
+// InitMeter initializes the global OpenTelemetry meter provider with the
+// configured metric exporters. The prometheus exporter registers with reg,
+// the registry served on /metrics, so the instruments are scraped next to
+// the native collectors.
+// Returns a shutdown function that flushes pending metrics and should be
+// called on application exit
+func InitMeter(cfg *config.Config, reg prometheus.Registerer) (func(context.Context) error, error) {
+	exporters := metricExporters(cfg.Telemetry)
+	if len(exporters) == 0 {
+		slog.Info("OpenTelemetry metrics disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	mp, err := newMeterProvider(context.Background(), cfg, exporters, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	otel.SetMeterProvider(mp)
+
+	slog.Info("OpenTelemetry metrics enabled",
+		"exporters", exporters,
+		"interval", cfg.Telemetry.Metrics.Interval,
+	)
+
+	return func(ctx context.Context) error {
+		if err := mp.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down meter provider", "error", err)
+			return err
+		}
+		return nil
+	}, nil
+}
+
+// metricExporters returns the configured metric exporters, leaving out otlp
+// when no endpoint is set
+func metricExporters(tc config.TelemetryConfig) []string {
+	var exporters []string
+	for _, name := range tc.Metrics.Exporters {
+		if name == "otlp" && tc.OTLPEndpoint == "" {
+			continue
+		}
+		exporters = append(exporters, name)
+	}
+	return exporters
+}
+
+// newMeterProvider creates a meter provider with a reader per exporter. The
+// prometheus exporter registers its collector with reg.
+func newMeterProvider(ctx context.Context, cfg *config.Config, exporters []string, reg prometheus.Registerer) (*sdkmetric.MeterProvider, error) {
+	var readers []sdkmetric.Reader
+	shutdown := func() {
+		for _, r := range readers {
+			r.Shutdown(ctx)
+		}
+	}
+
+	for _, name := range exporters {
+		reader, err := newMetricReader(ctx, cfg.Telemetry, name, reg)
+		if err != nil {
+			shutdown()
+			return nil, fmt.Errorf("creating %s metric exporter: %w", name, err)
+		}
+		readers = append(readers, reader)
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		shutdown()
+		return nil, fmt.Errorf("detecting telemetry resource: %w", err)
+	}
+
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	for _, r := range readers {
+		opts = append(opts, sdkmetric.WithReader(r))
+	}
+	return sdkmetric.NewMeterProvider(opts...), nil
+}
+
+// newMetricReader creates the reader of the named exporter. Push exporters
+// are read periodically; Prometheus is read on each scrape.
+func newMetricReader(ctx context.Context, cfg config.TelemetryConfig, name string, reg prometheus.Registerer) (sdkmetric.Reader, error) {
+	var exporter sdkmetric.Exporter
+	var err error
+	switch name {
+	case "prometheus":
+		return otelprom.New(otelprom.WithRegisterer(reg))
+	case "console":
+		exporter, err = stdoutmetric.New()
+	default:
+		exporter, err = newMetricExporter(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.Metrics.Interval)), nil
+}
+
+// newMetricExporter creates an OTLP metric exporter with the transport
+// settings of the span exporter
+func newMetricExporter(ctx context.Context, cfg config.TelemetryConfig) (sdkmetric.Exporter, error) {
+	var tlsConfig *tls.Config
+	if cfg.UseTLS() {
+		var err error
+		if tlsConfig, err = newTLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Protocol == "http/protobuf" {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithHeaders(cfg.Headers),
+			otlpmetrichttp.WithTimeout(cfg.Timeout),
+		}
+		endpoint, err := metricsEndpoint(cfg.OTLPEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(endpoint, "://") {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(endpoint))
+		}
+		if tlsConfig != nil {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		if cfg.Compression == "gzip" {
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+
+	opts := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithHeaders(cfg.Headers),
+		otlpmetricgrpc.WithTimeout(cfg.Timeout),
+	}
+	if strings.Contains(cfg.OTLPEndpoint, "://") {
+		opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.OTLPEndpoint))
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.OTLPEndpoint))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	if cfg.Compression == "gzip" {
+		opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+	}
+	return otlpmetricgrpc.New(ctx, opts...)
+}
+
+// metricsEndpoint returns the OTLP/HTTP metrics endpoint for the telemetry
+// endpoint: the host for URLs without a path, which selects the default
+// /v1/metrics path, and the URL with a /v1/traces path swapped otherwise
+func metricsEndpoint(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return u.Host, nil
+	}
+	if path, ok := strings.CutSuffix(u.Path, "/v1/traces"); ok {
+		u.Path = path + "/v1/metrics"
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,186 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// metricsReceiver is a fake OTLP collector recording the names of the
+// exported metrics and the request paths
+type metricsReceiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mu    sync.Mutex
+	names []string
+	paths []string
+}
+
+func (rc *metricsReceiver) record(req *collectormetrics.ExportMetricsServiceRequest, path string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				rc.names = append(rc.names, m.Name)
+			}
+		}
+	}
+	rc.paths = append(rc.paths, path)
+}
+
+// Export implements the OTLP gRPC metrics service
+func (rc *metricsReceiver) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	rc.record(req, "")
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+// ServeHTTP implements the OTLP/HTTP metrics endpoint with protobuf bodies
+func (rc *metricsReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	req := &collectormetrics.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rc.record(req, r.URL.Path)
+
+	resp, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+// exportCounter increments a counter named name and flushes it
+func exportCounter(t *testing.T, endpoint, protocol, name string) {
+	t.Helper()
+	ctx := context.Background()
+	cfg := testTelemetryConfig(endpoint)
+	cfg.Telemetry.Protocol = protocol
+	mp, err := newMeterProvider(ctx, cfg, []string{"otlp"}, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("newMeterProvider() returned an error: %v", err)
+	}
+	counter, _ := mp.Meter("test").Int64Counter(name)
+	counter.Add(ctx, 1)
+	if err := mp.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() returned an error: %v", err)
+	}
+}
+
+func TestExportMetricsGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	rc := &metricsReceiver{}
+	srv := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(srv, rc)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	exportCounter(t, lis.Addr().String(), "grpc", "orders.created")
+
+	if !slices.Contains(rc.names, "orders.created") {
+		t.Errorf("Expected orders.created to be exported, got %v", rc.names)
+	}
+}
+
+func TestExportMetricsHTTP(t *testing.T) {
+	rc := &metricsReceiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	exportCounter(t, srv.URL, "http/protobuf", "orders.created")
+	exportCounter(t, srv.URL+"/otlp/v1/traces", "http/protobuf", "orders.shipped")
+
+	if !slices.Contains(rc.names, "orders.created") || !slices.Contains(rc.names, "orders.shipped") {
+		t.Errorf("Expected both counters to be exported, got %v", rc.names)
+	}
+	if !slices.Equal(rc.paths, []string{"/v1/metrics", "/otlp/v1/metrics"}) {
+		t.Errorf("Expected the default and derived metrics paths, got %v", rc.paths)
+	}
+}
+
+func TestMeterProviderPrometheus(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	mp, err := newMeterProvider(ctx, testTelemetryConfig(""), []string{"prometheus"}, reg)
+	if err != nil {
+		t.Fatalf("newMeterProvider() returned an error: %v", err)
+	}
+	defer mp.Shutdown(ctx)
+
+	hist, _ := mp.Meter("test").Float64Histogram("checkout.duration", metric.WithUnit("s"))
+	hist.Record(ctx, 0.2, metric.WithAttributes(attribute.String("http.route", "/checkout")))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() returned an error: %v", err)
+	}
+	var names []string
+	for _, mf := range families {
+		names = append(names, mf.GetName())
+		if mf.GetName() != "checkout_duration_seconds" {
+			continue
+		}
+		h := mf.Metric[0].GetHistogram()
+		if h.GetSampleCount() != 1 || h.GetSampleSum() != 0.2 {
+			t.Errorf("Expected one sample of 0.2, got %d with sum %v", h.GetSampleCount(), h.GetSampleSum())
+		}
+	}
+	if !slices.Contains(names, "checkout_duration_seconds") {
+		t.Errorf("Expected checkout_duration_seconds to be registered, got %v", names)
+	}
+}
+
+func TestMetricExporters(t *testing.T) {
+	cfg := testTelemetryConfig("")
+	if got := metricExporters(cfg.Telemetry); !slices.Equal(got, []string{"prometheus"}) {
+		t.Errorf("Expected otlp to be skipped without an endpoint, got %v", got)
+	}
+	cfg.Telemetry.OTLPEndpoint = "collector:4317"
+	if got := metricExporters(cfg.Telemetry); !slices.Equal(got, []string{"prometheus", "otlp"}) {
+		t.Errorf("Expected prometheus and otlp, got %v", got)
+	}
+}
+
+func TestInitMeterDisabled(t *testing.T) {
+	cfg := testTelemetryConfig("")
+	cfg.Telemetry.Metrics.Exporters = []string{"otlp"}
+
+	shutdown, err := InitMeter(cfg, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("InitMeter() returned an error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected a no-op shutdown, got %v", err)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"collector:4318":                        "collector:4318",
+		"http://collector:4318":                 "collector:4318",
+		"https://collector/":                    "collector",
+		"https://collector/otlp/v1/traces":      "https://collector/otlp/v1/metrics",
+		"https://collector/custom/metrics/path": "https://collector/custom/metrics/path",
+	}
+	for endpoint, want := range tests {
+		got, err := metricsEndpoint(endpoint)
+		if err != nil || got != want {
+			t.Errorf("metricsEndpoint(%q) = %q, %v; expected %q", endpoint, got, err, want)
+		}
+	}
+}
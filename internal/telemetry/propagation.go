@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HTTPClient is the shared client for outbound calls. Each request gets a
+// client span, and the trace context and baggage of its context are
+// injected with the configured propagators.
+var HTTPClient = NewHTTPClient(30 * time.Second)
+
+// NewHTTPClient creates an instrumented HTTP client with the given timeout
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method
+			}),
+		),
+		Timeout: timeout,
+	}
+}
+
+// newPropagator combines the named propagators. Extraction tries each in
+// order, so the later ones win when a request carries several formats.
+func newPropagator(names []string) propagation.TextMapPropagator {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New())
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			propagators = append(propagators, jaeger.Jaeger{})
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...)
+}
@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewPropagator(t *testing.T) {
+	p := newPropagator([]string{"tracecontext", "baggage", "b3multi", "jaeger"})
+	for _, field := range []string{"traceparent", "baggage", "x-b3-traceid", "uber-trace-id"} {
+		if !slices.Contains(p.Fields(), field) {
+			t.Errorf("Expected field %s, got %v", field, p.Fields())
+		}
+	}
+
+	// Each configured format is extracted
+	headers := map[string]string{
+		"traceparent":   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"b3":            "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1",
+		"uber-trace-id": "3ce929d0e0e4736b7f92f3577b34da6a:00f067aa0ba902b7:0:1",
+	}
+	for name, value := range headers {
+		p := newPropagator([]string{"tracecontext", "b3", "jaeger"})
+		ctx := p.Extract(context.Background(), propagation.MapCarrier{name: value})
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			t.Errorf("Expected a trace context extracted from %s", name)
+		}
+	}
+
+	if fields := newPropagator(nil).Fields(); len(fields) != 0 {
+		t.Errorf("Expected no fields without propagators, got %v", fields)
+	}
+}
+
+func TestHTTPClientPropagates(t *testing.T) {
+	otel.SetTextMapPropagator(newPropagator([]string{"tracecontext", "baggage"}))
+
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+	member, _ := baggage.NewMember("tenant", "acme")
+	bag, _ := baggage.New(member)
+	ctx = baggage.ContextWithBaggage(ctx, bag)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(got)))
+	if sc.TraceID() != traceID {
+		t.Errorf("Expected the trace to be propagated, got traceparent %q", got.Get("traceparent"))
+	}
+	if got.Get("baggage") != "tenant=acme" {
+		t.Errorf("Expected the baggage to be propagated, got %q", got.Get("baggage"))
+	}
+}
@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// newResource describes the service, the host, the process, its container
+// and Kubernetes pod. The service name is telemetry.service_name, the
+// service.name resource attribute or app.name, in that order.
+func newResource(ctx context.Context, cfg *config.Config) (*resource.Resource, error) {
+	tc := cfg.Telemetry
+	var attrs []attribute.KeyValue
+	for k, v := range tc.ResourceAttributes {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+
+	serviceName := tc.ServiceName
+	if serviceName == "" {
+		serviceName = tc.ResourceAttributes[string(semconv.ServiceNameKey)]
+	}
+	if serviceName == "" {
+		serviceName = cfg.App.Name
+	}
+	attrs = append(attrs,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(cfg.App.Version),
+		semconv.DeploymentEnvironmentName(cfg.Environment),
+	)
+
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithProcess(),
+		resource.WithContainer(),
+		resource.WithDetectors(kubernetesDetector{}),
+		resource.WithAttributes(attrs...),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		// Some detectors fail outside their environment, e.g. without a
+		// user database in the container; keep what was detected
+		slog.Debug("Partial telemetry resource", "error", err)
+		err = nil
+	}
+	return res, err
+}
+
+// kubernetesDetector reads the pod's name, namespace and node from the
+// POD_NAME, POD_NAMESPACE and NODE_NAME variables set with the downward API
+type kubernetesDetector struct{}
+
+// Detect implements resource.Detector
+func (kubernetesDetector) Detect(context.Context) (*resource.Resource, error) {
+	var attrs []attribute.KeyValue
+	if v := os.Getenv("POD_NAME"); v != "" {
+		attrs = append(attrs, semconv.K8SPodName(v))
+	}
+	if v := os.Getenv("POD_NAMESPACE"); v != "" {
+		attrs = append(attrs, semconv.K8SNamespaceName(v))
+	}
+	if v := os.Getenv("NODE_NAME"); v != "" {
+		attrs = append(attrs, semconv.K8SNodeName(v))
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...), nil
+}
@@ -0,0 +1,67 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+func resourceAttributes(t *testing.T, cfg *config.Config) map[string]string {
+	t.Helper()
+	res, err := newResource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("newResource() returned an error: %v", err)
+	}
+	attrs := make(map[string]string)
+	for _, kv := range res.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+func TestNewResource(t *testing.T) {
+	t.Setenv("POD_NAME", "learn-go-abc")
+	t.Setenv("POD_NAMESPACE", "apps")
+	t.Setenv("NODE_NAME", "node-1")
+	cfg := config.Default()
+	cfg.Telemetry.ResourceAttributes = map[string]string{"service.name": "from-attributes", "team": "platform"}
+
+	attrs := resourceAttributes(t, cfg)
+
+	want := map[string]string{
+		"service.name":                "from-attributes",
+		"service.version":             cfg.App.Version,
+		"deployment.environment.name": "development",
+		"team":                        "platform",
+		"k8s.pod.name":                "learn-go-abc",
+		"k8s.namespace.name":          "apps",
+		"k8s.node.name":               "node-1",
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("Expected %s=%q, got %q", k, v, attrs[k])
+		}
+	}
+	for _, k := range []string{"host.name", "os.type", "process.pid", "process.runtime.name"} {
+		if attrs[k] == "" {
+			t.Errorf("Expected %s to be detected", k)
+		}
+	}
+
+	// Resource and HTTP metric attributes follow the same conventions
+	res, _ := newResource(context.Background(), cfg)
+	if res.SchemaURL() != semconv.SchemaURL {
+		t.Errorf("Expected schema %s, got %s", semconv.SchemaURL, res.SchemaURL())
+	}
+
+	cfg.Telemetry.ServiceName = "checkout"
+	if got := resourceAttributes(t, cfg)["service.name"]; got != "checkout" {
+		t.Errorf("Expected service_name to take precedence, got %q", got)
+	}
+	cfg.Telemetry = config.Default().Telemetry
+	if got := resourceAttributes(t, cfg)["service.name"]; got != "learn-go" {
+		t.Errorf("Expected app.name as the default service name, got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dxas90/learn-go/internal/config"
+	"github.com/dxas90/learn-go/internal/ratelimit"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newSampler creates the sampler described by the configuration
+func newSampler(cfg config.SamplerConfig) sdktrace.Sampler {
+	name, parentBased := strings.CutPrefix(cfg.Type, "parentbased_")
+
+	var sampler sdktrace.Sampler
+	switch name {
+	case "always_off":
+		sampler = sdktrace.NeverSample()
+	case "traceidratio":
+		sampler = sdktrace.TraceIDRatioBased(cfg.Arg)
+	case "ratelimited":
+		sampler = newRateLimitedSampler(cfg.Arg)
+	default:
+		sampler = sdktrace.AlwaysSample()
+	}
+
+	if parentBased {
+		return sdktrace.ParentBased(sampler)
+	}
+	return sampler
+}
+
+// rateLimitedSampler samples at most a number of traces per second, with
+// bursts of up to one second's worth
+type rateLimitedSampler struct {
+	store     *ratelimit.MemoryStore
+	limit     ratelimit.Limit
+	perSecond float64
+}
+
+func newRateLimitedSampler(perSecond float64) *rateLimitedSampler {
+	// Rates below one trace per second refill a single token more slowly
+	requests := max(1, int(math.Floor(perSecond)))
+	return &rateLimitedSampler{
+		store: ratelimit.NewMemoryStore(),
+		limit: ratelimit.Limit{
+			Requests: requests,
+			Period:   time.Duration(float64(requests) / perSecond * float64(time.Second)),
+		},
+		perSecond: perSecond,
+	}
+}
+
+// ShouldSample implements sdktrace.Sampler
+func (s *rateLimitedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if res, _ := s.store.Take(p.ParentContext, "traces", s.limit); res.Allowed {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+// Description implements sdktrace.Sampler
+func (s *rateLimitedSampler) Description() string {
+	return fmt.Sprintf("RateLimited{%g}", s.perSecond)
+}
@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sampled reports whether sampler samples a root span, or a child of a
+// parent with the given sampled flag
+func sampled(sampler sdktrace.Sampler, parent *bool) bool {
+	ctx := context.Background()
+	if parent != nil {
+		flags := trace.TraceFlags(0)
+		if *parent {
+			flags = trace.FlagsSampled
+		}
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: flags,
+			Remote:     true,
+		}))
+	}
+	res := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: ctx, TraceID: trace.TraceID{2}, Name: "span"})
+	return res.Decision == sdktrace.RecordAndSample
+}
+
+func TestNewSampler(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		sampler config.SamplerConfig
+		parent  *bool
+		want    bool
+	}{
+		{config.SamplerConfig{Type: "always_on"}, &no, true},
+		{config.SamplerConfig{Type: "always_off"}, &yes, false},
+		{config.SamplerConfig{Type: "traceidratio", Arg: 0}, nil, false},
+		{config.SamplerConfig{Type: "traceidratio", Arg: 1}, nil, true},
+		{config.SamplerConfig{Type: "parentbased_always_off"}, &yes, true},
+		{config.SamplerConfig{Type: "parentbased_always_on"}, &no, false},
+		{config.SamplerConfig{Type: "parentbased_always_on"}, nil, true},
+		{config.SamplerConfig{Type: "parentbased_traceidratio", Arg: 0}, nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := sampled(newSampler(tt.sampler), tt.parent); got != tt.want {
+			t.Errorf("%+v with parent %v: expected sampled=%v, got %v", tt.sampler, tt.parent, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimitedSampler(t *testing.T) {
+	sampler := newSampler(config.SamplerConfig{Type: "ratelimited", Arg: 3})
+
+	var count int
+	for range 10 {
+		if sampled(sampler, nil) {
+			count++
+		}
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 traces sampled in a burst, got %d", count)
+	}
+	if got := sampler.Description(); got != "RateLimited{3}" {
+		t.Errorf("Unexpected description %q", got)
+	}
+
+	slow := newRateLimitedSampler(0.5)
+	if slow.limit.Requests != 1 || slow.limit.Period.Seconds() != 2 {
+		t.Errorf("Expected one trace every 2s, got %+v", slow.limit)
+	}
+}
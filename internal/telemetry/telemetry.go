@@ -2,66 +2,74 @@ package telemetry
 
 import (
 	"context"
-	"log"
-	"os"
-	"time"
+	"fmt"
+	"log/slog"
 
+	"github.com/dxas90/learn-go/internal/config"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
-// InitTracer initializes the OpenTelemetry tracer with OTLP exporter
-// Returns a shutdown function that should be called on application exit
-func InitTracer() (func(), error) {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		log.Println("[INFO] OpenTelemetry tracing disabled (OTEL_EXPORTER_OTLP_ENDPOINT not set)")
-		return func() {}, nil
-	}
-
-	ctx := context.Background()
+// InitTracer initializes the global OpenTelemetry tracer provider with the
+// configured exporter, sampler and detected resource, and the global
+// propagator. The trace context is propagated even with tracing disabled.
+// Returns a shutdown function that flushes pending spans and should be called
+// on application exit
+func InitTracer(cfg *config.Config) (func(context.Context) error, error) {
+	tc := cfg.Telemetry
+	otel.SetTextMapPropagator(newPropagator(tc.Propagators))
 
-	// Create OTLP trace exporter
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(endpoint),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		return nil, err
+	switch {
+	case tc.Exporter == "none":
+		slog.Info("OpenTelemetry tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	case tc.Exporter == "otlp" && tc.OTLPEndpoint == "":
+		slog.Info("OpenTelemetry tracing disabled (OTEL_EXPORTER_OTLP_ENDPOINT not set)")
+		return func(context.Context) error { return nil }, nil
 	}
 
-	// Create resource with service information
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("learn-go"),
-			semconv.ServiceVersion(os.Getenv("APP_VERSION")),
-			semconv.DeploymentEnvironment(os.Getenv("GO_ENV")),
-		),
-	)
+	tp, err := newTracerProvider(context.Background(), cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create tracer provider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-	)
-
 	otel.SetTracerProvider(tp)
 
-	log.Println("[INFO] OpenTelemetry tracing enabled")
+	slog.Info("OpenTelemetry tracing enabled",
+		"exporter", tc.Exporter,
+		"endpoint", tc.OTLPEndpoint,
+		"protocol", tc.Protocol,
+		"sampler", tc.Sampler.Type,
+		"propagators", tc.Propagators,
+	)
 
 	// Return shutdown function
-	return func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	return func(ctx context.Context) error {
 		if err := tp.Shutdown(ctx); err != nil {
-			log.Printf("[ERROR] Error shutting down tracer provider: %v", err)
+			slog.Error("Error shutting down tracer provider", "error", err)
+			return err
 		}
+		return nil
 	}, nil
 }
+
+// newTracerProvider creates a tracer provider batching spans to the
+// configured exporter
+func newTracerProvider(ctx context.Context, cfg *config.Config) (*sdktrace.TracerProvider, error) {
+	exporter, err := newExporter(ctx, cfg.Telemetry)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s span exporter: %w", cfg.Telemetry.Exporter, err)
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		exporter.Shutdown(ctx)
+		return nil, fmt.Errorf("detecting telemetry resource: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(newSampler(cfg.Telemetry.Sampler)),
+	), nil
+}
@@ -0,0 +1,255 @@
+package telemetry
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dxas90/learn-go/internal/config"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver is a fake OTLP collector recording the exported spans and the
+// request headers
+type receiver struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu       sync.Mutex
+	requests []*collectortrace.ExportTraceServiceRequest
+	headers  map[string]string
+}
+
+func (rc *receiver) record(req *collectortrace.ExportTraceServiceRequest, headers map[string]string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, req)
+	rc.headers = headers
+}
+
+// Export implements the OTLP gRPC trace service
+func (rc *receiver) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	headers := make(map[string]string)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		headers[k] = v[0]
+	}
+	rc.record(req, headers)
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// ServeHTTP implements the OTLP/HTTP trace endpoint with protobuf bodies
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, _ := io.ReadAll(body)
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(data, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	headers := make(map[string]string)
+	for k := range r.Header {
+		headers[strings.ToLower(k)] = r.Header.Get(k)
+	}
+	headers["content-encoding"] = r.Header.Get("Content-Encoding")
+	rc.record(req, headers)
+
+	resp, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+// spans returns the names of the exported spans and the attributes of
+// their resource
+func (rc *receiver) spans() ([]string, map[string]string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var names []string
+	attrs := make(map[string]string)
+	for _, req := range rc.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, kv := range rs.GetResource().GetAttributes() {
+				attrs[kv.Key] = kv.Value.GetStringValue()
+			}
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					names = append(names, s.Name)
+				}
+			}
+		}
+	}
+	return names, attrs
+}
+
+func testTelemetryConfig(endpoint string) *config.Config {
+	cfg := config.Default()
+	cfg.Environment = "test"
+	cfg.Telemetry.OTLPEndpoint = endpoint
+	cfg.Telemetry.Headers = map[string]string{"x-tenant": "learn"}
+	cfg.Telemetry.ResourceAttributes = map[string]string{"team": "platform"}
+	return cfg
+}
+
+// exportSpan records one span named name and flushes it
+func exportSpan(t *testing.T, cfg *config.Config, name string) {
+	t.Helper()
+	ctx := context.Background()
+	tp, err := newTracerProvider(ctx, cfg)
+	if err != nil {
+		t.Fatalf("newTracerProvider() returned an error: %v", err)
+	}
+	_, span := tp.Tracer("test").Start(ctx, name)
+	span.End()
+	if err := tp.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() returned an error: %v", err)
+	}
+}
+
+func checkExport(t *testing.T, rc *receiver, name string) {
+	t.Helper()
+	names, attrs := rc.spans()
+	if len(names) != 1 || names[0] != name {
+		t.Fatalf("Expected span %s to be exported, got %v", name, names)
+	}
+	if attrs["service.name"] != "learn-go" || attrs["deployment.environment.name"] != "test" || attrs["team"] != "platform" {
+		t.Errorf("Expected the configured resource attributes, got %v", attrs)
+	}
+	if attrs["host.name"] == "" || attrs["telemetry.sdk.language"] != "go" {
+		t.Errorf("Expected detected resource attributes, got %v", attrs)
+	}
+	if rc.headers["x-tenant"] != "learn" {
+		t.Errorf("Expected the configured headers, got %v", rc.headers)
+	}
+}
+
+func TestExportGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	rc := &receiver{}
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, rc)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	for _, endpoint := range []string{lis.Addr().String(), "http://" + lis.Addr().String()} {
+		rc.requests = nil
+		exportSpan(t, testTelemetryConfig(endpoint), "grpc-span")
+		checkExport(t, rc, "grpc-span")
+	}
+}
+
+func TestExportHTTP(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	cfg := testTelemetryConfig(srv.URL)
+	cfg.Telemetry.Protocol = "http/protobuf"
+	cfg.Telemetry.Compression = "gzip"
+	exportSpan(t, cfg, "http-span")
+
+	checkExport(t, rc, "http-span")
+	if rc.headers["content-encoding"] != "gzip" {
+		t.Errorf("Expected a gzip request, got %q", rc.headers["content-encoding"])
+	}
+}
+
+func TestExportHTTPTLS(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewTLSServer(rc)
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+
+	cfg := testTelemetryConfig(strings.TrimPrefix(srv.URL, "https://"))
+	cfg.Telemetry.Protocol = "http/protobuf"
+	cfg.Telemetry.Insecure = false
+	cfg.Telemetry.TLS.CAFile = caFile
+	exportSpan(t, cfg, "tls-span")
+
+	checkExport(t, rc, "tls-span")
+}
+
+func TestExportFile(t *testing.T) {
+	cfg := testTelemetryConfig("")
+	cfg.Telemetry.Exporter = "file"
+	cfg.Telemetry.File = filepath.Join(t.TempDir(), "traces.jsonl")
+
+	exportSpan(t, cfg, "file-span")
+	exportSpan(t, cfg, "second-span")
+
+	f, err := os.Open(cfg.Telemetry.File)
+	if err != nil {
+		t.Fatalf("Failed to open the traces file: %v", err)
+	}
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span struct{ Name string }
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("Failed to parse span line: %v", err)
+		}
+		names = append(names, span.Name)
+	}
+	if strings.Join(names, ",") != "file-span,second-span" {
+		t.Errorf("Expected both spans appended to the file, got %v", names)
+	}
+}
+
+func TestInitTracerDisabled(t *testing.T) {
+	for _, exporter := range []string{"none", "otlp"} {
+		cfg := testTelemetryConfig("")
+		cfg.Telemetry.Exporter = exporter
+
+		shutdown, err := InitTracer(cfg)
+		if err != nil {
+			t.Fatalf("InitTracer() returned an error: %v", err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("Expected a no-op shutdown, got %v", err)
+		}
+	}
+}
+
+func TestNewExporterInvalidCA(t *testing.T) {
+	cfg := testTelemetryConfig("collector:4317")
+	cfg.Telemetry.Insecure = false
+	cfg.Telemetry.TLS.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+
+	if _, err := newTracerProvider(context.Background(), cfg); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+}
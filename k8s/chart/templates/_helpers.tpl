@@ -52,3 +52,22 @@ app.kubernetes.io/instance: {{ .Release.Name }}
 {{- end }}
 {{- end }}
 
+
+{{/*
+Render a probe, pointing it at the admin port when the admin listener is enabled.
+Usage: include "base.probe" (dict "probe" .Values.livenessProbe "root" $)
+*/}}
+{{- define "base.probe" -}}
+{{- $probe := deepCopy .probe }}
+{{- if and .root.Values.admin.enabled $probe.httpGet }}
+{{- $_ := set $probe.httpGet "port" "admin" }}
+{{- end }}
+{{- toYaml $probe }}
+{{- end }}
+
+{{/*
+Port scraped by Prometheus
+*/}}
+{{- define "base.metricsPort" -}}
+{{- if .Values.admin.enabled }}{{ .Values.admin.port }}{{ else }}{{ .Values.service.port }}{{ end }}
+{{- end }}
@@ -22,6 +22,7 @@ type ErrorResponse struct {
 	Error      bool   `json:"error"`
 	Message    string `json:"message"`
 	StatusCode int    `json:"statusCode"`
+	RequestID  string `json:"requestId,omitempty"`
 	Timestamp  string `json:"timestamp"`
 }
 
@@ -119,3 +120,36 @@ type EchoData struct {
 	Headers map[string]string `json:"headers"`
 	Method  string            `json:"method"`
 }
+
+// LogLevelData for the admin log level endpoint
+type LogLevelData struct {
+	Level string `json:"level"`
+}
+
+// APIKeyData describes an API key for the admin API key endpoints.
+// Key holds the plaintext key and is only set when the key is created.
+type APIKeyData struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Scopes    []string       `json:"scopes"`
+	CreatedAt string         `json:"created_at"`
+	ExpiresAt string         `json:"expires_at,omitempty"`
+	RevokedAt string         `json:"revoked_at,omitempty"`
+	RateLimit *RateLimitData `json:"rate_limit,omitempty"`
+	Key       string         `json:"key,omitempty"`
+}
+
+// RateLimitData is a quota of Requests per Period, a duration such as "1m"
+type RateLimitData struct {
+	Requests int    `json:"requests"`
+	Period   string `json:"period"`
+}
+
+// CreateAPIKeyRequest is the body of an API key creation request.
+// ExpiresIn is a duration such as "720h"; keys without one never expire.
+type CreateAPIKeyRequest struct {
+	Name      string         `json:"name"`
+	Scopes    []string       `json:"scopes"`
+	ExpiresIn string         `json:"expires_in,omitempty"`
+	RateLimit *RateLimitData `json:"rate_limit,omitempty"`
+}
@@ -65,7 +65,7 @@ spec:
     - containerPort: 8080
     readinessProbe:
       httpGet:
-        path: /healthz
+        path: /readyz
         port: 8080
       initialDelaySeconds: 5
       periodSeconds: 10